@@ -0,0 +1,62 @@
+/*
+Copyright © 2020 Arnoud Kleinloog
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"github.com/akleinloog/lazy-rest/app"
+	"github.com/akleinloog/lazy-rest/pkg/storage"
+	"github.com/spf13/cobra"
+)
+
+// migrateCmd represents the migrate command
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Converts a data directory to the current layout",
+	Long: `Converts a data directory that was written by an older version to the current layout.
+Documents are stored in files with a .json or .data extension, next to the
+directories of their sub-collections. The server refuses to start until an
+older data directory has been converted.
+
+Use --dry-run to list the files that would be renamed, without renaming them.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		migrations, err := storage.MigrateFileStore(app.Config.DataDir(), dryRun)
+		if err != nil {
+			app.Log.Fatal(err, "Unable to migrate the data directory")
+		}
+
+		for _, migration := range migrations {
+			fmt.Printf("%s -> %s\n", migration.From, migration.To)
+		}
+
+		switch {
+		case len(migrations) == 0:
+			fmt.Printf("Data directory %s already uses the current layout\n", app.Config.DataDir())
+		case dryRun:
+			fmt.Printf("Would rename %d files and directories in %s\n", len(migrations), app.Config.DataDir())
+		default:
+			fmt.Printf("Renamed %d files and directories in %s\n", len(migrations), app.Config.DataDir())
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(migrateCmd)
+
+	migrateCmd.Flags().Bool("dry-run", false, "list the files that would be renamed, without renaming them")
+}
@@ -16,8 +16,15 @@ limitations under the License.
 package cmd
 
 import (
+	"crypto/tls"
+	"errors"
+	"github.com/akleinloog/lazy-rest/app"
+	"github.com/akleinloog/lazy-rest/config"
+	"github.com/akleinloog/lazy-rest/pkg/certificate"
 	"github.com/akleinloog/lazy-rest/pkg/rest"
+	"github.com/akleinloog/lazy-rest/pkg/storage"
 	"github.com/spf13/cobra"
+	"io/ioutil"
 )
 
 // serveCmd represents the serve command
@@ -25,12 +32,152 @@ var serveCmd = &cobra.Command{
 	Use:   "serve",
 	Short: "Starts the REST Server",
 	Long: `Starts the REST Server at port 8080.
-It will start accepting requests, returning what has been put in.`,
+It will start accepting requests, returning what has been put in.
+
+Use --tls-cert and --tls-key to serve HTTPS, or --tls-self-signed to serve HTTPS
+with a generated certificate for localhost. HTTP/2 is negotiated automatically.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		rest.Listen()
+		store, err := storage.New(&app.Config)
+		if err != nil {
+			app.Log.Fatal(err, "Unable to prepare storage")
+		}
+
+		options := []rest.Option{
+			rest.WithHost(app.Config.Host()),
+			rest.WithPort(app.Config.Port()),
+			rest.WithStore(store),
+			rest.WithTimeouts(rest.Timeouts{
+				Read:           app.Config.ReadTimeout(),
+				Write:          app.Config.WriteTimeout(),
+				Idle:           app.Config.IdleTimeout(),
+				Shutdown:       app.Config.ShutdownTimeout(),
+				MaxHeaderBytes: app.Config.MaxHeaderBytes(),
+			}),
+		}
+
+		if app.Config.ObjectsOnly() {
+			options = append(options, rest.WithObjectsOnly())
+		}
+
+		if app.Config.ReadOnly() {
+			options = append(options, rest.WithReadOnly())
+		}
+
+		options = append(options, rest.WithIdempotencyWindow(app.Config.IdempotencyWindow()))
+
+		if app.Config.Upsert() {
+			options = append(options, rest.WithUpsert())
+		}
+
+		options = append(options, rest.WithIDField(app.Config.IDField()), rest.WithIDStrategy(app.Config.IDStrategy()))
+		for prefix, strategy := range app.Config.IDStrategies() {
+			options = append(options, rest.WithIDStrategyFor(prefix, strategy))
+		}
+
+		for pattern, file := range app.Config.Schemas() {
+			schema, err := ioutil.ReadFile(file)
+			if err != nil {
+				app.Log.Fatal(err, "Unable to read JSON Schema")
+			}
+			options = append(options, rest.WithSchema(pattern, schema))
+		}
+
+		if app.Config.StrictSchemas() {
+			options = append(options, rest.WithStrictSchemas())
+		}
+
+		if app.Config.HistoryEnabled() {
+			options = append(options, rest.WithHistory(storage.Retention{
+				Count: app.Config.HistoryCount(),
+				Age:   app.Config.HistoryAge(),
+			}))
+		}
+
+		if app.Config.ManagedFieldsEnabled() {
+			options = append(options, rest.WithManagedFields(rest.ManagedFields{
+				CreatedAt:       app.Config.CreatedAtField(),
+				UpdatedAt:       app.Config.UpdatedAtField(),
+				Version:         app.Config.VersionField(),
+				CreatedBy:       app.Config.CreatedByField(),
+				TimestampFormat: app.Config.TimestampFormat(),
+				UserHeader:      app.Config.UserHeader(),
+				Reject:          app.Config.RejectManagedFields(),
+				HeadersOnly:     app.Config.ManagedFieldsInHeadersOnly(),
+			}))
+		}
+
+		if len(app.Config.CORSOrigins()) > 0 {
+			options = append(options, rest.WithCORS(rest.CORS{
+				AllowedOrigins:   app.Config.CORSOrigins(),
+				EchoOrigin:       app.Config.CORSEchoOrigin(),
+				AllowedMethods:   app.Config.CORSMethods(),
+				AllowedHeaders:   app.Config.CORSHeaders(),
+				ExposedHeaders:   app.Config.CORSExposedHeaders(),
+				AllowCredentials: app.Config.CORSCredentials(),
+				MaxAge:           app.Config.CORSMaxAge(),
+			}))
+		}
+
+		if app.Config.TLSEnabled() {
+			tlsConfig, err := tlsConfiguration()
+			if err != nil {
+				app.Log.Fatal(err, "Unable to prepare TLS")
+			}
+			options = append(options, rest.WithTLS(tlsConfig))
+			if app.Config.TLSPort() != 0 {
+				options = append(options, rest.WithTLSPort(app.Config.TLSPort()))
+			}
+		}
+
+		server, err := rest.New(options...)
+		if err != nil {
+			app.Log.Fatal(err, "Unable to create the REST Server")
+		}
+		server.Listen()
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(serveCmd)
+
+	config.InitializeServeFlags(serveCmd)
+}
+
+// tlsConfiguration loads the certificate to serve HTTPS with, or generates a self-signed one.
+func tlsConfiguration() (*tls.Config, error) {
+
+	var certificates []tls.Certificate
+
+	if app.Config.TLSSelfSigned() {
+
+		selfSigned, err := certificate.GenerateSelfSigned(app.Config.Host())
+		if err != nil {
+			return nil, err
+		}
+
+		if app.Config.TLSCAOut() != "" {
+			err = selfSigned.WriteCertificateAuthority(app.Config.TLSCAOut())
+			if err != nil {
+				return nil, err
+			}
+			app.Log.Info().Str("file", app.Config.TLSCAOut()).Msg("Certificate authority of the self-signed certificate written")
+		}
+
+		certificates = append(certificates, selfSigned.Certificate)
+
+	} else {
+
+		if app.Config.TLSCert() == "" || app.Config.TLSKey() == "" {
+			return nil, errors.New("both --tls-cert and --tls-key are required to serve HTTPS")
+		}
+
+		loaded, err := tls.LoadX509KeyPair(app.Config.TLSCert(), app.Config.TLSKey())
+		if err != nil {
+			return nil, err
+		}
+
+		certificates = append(certificates, loaded)
+	}
+
+	return &tls.Config{Certificates: certificates, MinVersion: tls.VersionTLS12}, nil
 }
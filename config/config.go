@@ -22,6 +22,7 @@ import (
 	"github.com/spf13/viper"
 	"os"
 	"strings"
+	"time"
 )
 
 type Config struct {
@@ -46,6 +47,275 @@ func (*Config) InMemory() bool {
 	return viper.GetBool("in-memory")
 }
 
+// Host returns the host name or IP address the HTTP Server binds to, all interfaces when empty.
+func (*Config) Host() string {
+	return viper.GetString("host")
+}
+
+// DataDir returns the directory that is used for storage when not running in memory.
+func (*Config) DataDir() string {
+	dataDir := viper.GetString("data-dir")
+	if dataDir == "" {
+		dataDir = "./data"
+	}
+	return dataDir
+}
+
+// ObjectsOnly indicates if only JSON objects can be stored, rejecting arrays, strings, numbers and null.
+func (*Config) ObjectsOnly() bool {
+	return viper.GetBool("objects-only")
+}
+
+// ReadOnly indicates if requests that change documents are rejected, so the server only serves what it holds.
+func (*Config) ReadOnly() bool {
+	return viper.GetBool("read-only")
+}
+
+// ShutdownTimeout returns how long requests in progress are given to complete when the server shuts down.
+func (*Config) ShutdownTimeout() time.Duration {
+	return durationOrDefault("shutdown-timeout", 30*time.Second)
+}
+
+// ReadTimeout returns the maximum duration for reading an entire request, including the body.
+func (*Config) ReadTimeout() time.Duration {
+	return durationOrDefault("read-timeout", 30*time.Second)
+}
+
+// WriteTimeout returns the maximum duration before timing out writes of the response.
+func (*Config) WriteTimeout() time.Duration {
+	return durationOrDefault("write-timeout", 60*time.Second)
+}
+
+// IdleTimeout returns the maximum amount of time to wait for the next request on a keep-alive connection.
+func (*Config) IdleTimeout() time.Duration {
+	return durationOrDefault("idle-timeout", 120*time.Second)
+}
+
+// MaxHeaderBytes returns the maximum number of bytes the server will read parsing the request headers.
+func (*Config) MaxHeaderBytes() int {
+	maxHeaderBytes := viper.GetInt("max-header-bytes")
+	if maxHeaderBytes == 0 {
+		maxHeaderBytes = 1 << 20
+	}
+	return maxHeaderBytes
+}
+
+// HistoryCount returns how many versions of each document are kept in its history, unlimited when 0.
+func (*Config) HistoryCount() int {
+	return viper.GetInt("history-count")
+}
+
+// HistoryAge returns how long versions of documents are kept in their history, unlimited when 0.
+func (*Config) HistoryAge() time.Duration {
+	return viper.GetDuration("history-age")
+}
+
+// HistoryEnabled indicates if the history of documents should be kept, which is the case when it is limited.
+func (config *Config) HistoryEnabled() bool {
+	return config.HistoryCount() > 0 || config.HistoryAge() > 0
+}
+
+// Upsert indicates if POST replaces items that already exist, instead of rejecting them.
+func (*Config) Upsert() bool {
+	return viper.GetBool("upsert")
+}
+
+// IdempotencyWindow returns how long responses to POST requests with an Idempotency-Key are remembered,
+// 24 hours when it is not set. A window of 0 or less disables this.
+func (*Config) IdempotencyWindow() time.Duration {
+	if !viper.IsSet("idempotency-window") {
+		return 24 * time.Hour
+	}
+	return viper.GetDuration("idempotency-window")
+}
+
+// IDField returns the name of the field that holds the id of objects.
+func (*Config) IDField() string {
+	idField := viper.GetString("id-field")
+	if idField == "" {
+		idField = "id"
+	}
+	return idField
+}
+
+// IDStrategy returns how ids are generated for objects that are posted without one.
+func (*Config) IDStrategy() string {
+	idStrategy := viper.GetString("id-strategy")
+	if idStrategy == "" {
+		idStrategy = "random"
+	}
+	return idStrategy
+}
+
+// IDStrategies returns how ids are generated per path prefix, set as prefix=strategy.
+// Entries without a prefix set the strategy for all other paths.
+func (*Config) IDStrategies() map[string]string {
+	strategies := make(map[string]string)
+	for _, value := range stringSlice("id-strategies") {
+		prefix, strategy := "", value
+		if separator := strings.LastIndex(value, "="); separator >= 0 {
+			prefix, strategy = strings.TrimSpace(value[:separator]), strings.TrimSpace(value[separator+1:])
+		}
+		strategies[prefix] = strategy
+	}
+	return strategies
+}
+
+// Schemas returns the files holding the JSON Schemas per collection pattern, set as pattern=file.
+func (*Config) Schemas() map[string]string {
+	schemas := make(map[string]string)
+	for _, value := range stringSlice("schemas") {
+		if separator := strings.Index(value, "="); separator >= 0 {
+			schemas[strings.TrimSpace(value[:separator])] = strings.TrimSpace(value[separator+1:])
+		}
+	}
+	return schemas
+}
+
+// StrictSchemas indicates if items are rejected for collections that no JSON Schema is registered for.
+func (*Config) StrictSchemas() bool {
+	return viper.GetBool("strict")
+}
+
+// CreatedAtField returns the name of the field holding when an object was first stored, not maintained when empty.
+func (*Config) CreatedAtField() string {
+	return viper.GetString("created-at-field")
+}
+
+// UpdatedAtField returns the name of the field holding when an object was last stored, not maintained when empty.
+func (*Config) UpdatedAtField() string {
+	return viper.GetString("updated-at-field")
+}
+
+// VersionField returns the name of the field counting how often an object was stored, not maintained when empty.
+func (*Config) VersionField() string {
+	return viper.GetString("version-field")
+}
+
+// CreatedByField returns the name of the field holding who first stored an object, not maintained when empty.
+func (*Config) CreatedByField() string {
+	return viper.GetString("created-by-field")
+}
+
+// ManagedFieldsEnabled indicates if the server maintains any fields in the objects it stores.
+func (config *Config) ManagedFieldsEnabled() bool {
+	return config.CreatedAtField() != "" || config.UpdatedAtField() != "" || config.VersionField() != "" || config.CreatedByField() != ""
+}
+
+// TimestampFormat returns the format of the timestamps in managed fields.
+func (*Config) TimestampFormat() string {
+	timestampFormat := viper.GetString("timestamp-format")
+	if timestampFormat == "" {
+		timestampFormat = "rfc3339"
+	}
+	return timestampFormat
+}
+
+// UserHeader returns the request header that identifies the user for the created by field.
+func (*Config) UserHeader() string {
+	userHeader := viper.GetString("user-header")
+	if userHeader == "" {
+		userHeader = "Authorization"
+	}
+	return userHeader
+}
+
+// RejectManagedFields indicates if requests that change managed fields are rejected, instead of ignoring the changes.
+func (*Config) RejectManagedFields() bool {
+	return viper.GetBool("reject-managed-fields")
+}
+
+// ManagedFieldsInHeadersOnly indicates if managed fields are left out of responses, and only sent as headers.
+func (*Config) ManagedFieldsInHeadersOnly() bool {
+	return viper.GetBool("managed-headers-only")
+}
+
+// TLSCert returns the location of the PEM encoded certificate to serve HTTPS with.
+func (*Config) TLSCert() string {
+	return viper.GetString("tls-cert")
+}
+
+// TLSKey returns the location of the PEM encoded private key of the certificate to serve HTTPS with.
+func (*Config) TLSKey() string {
+	return viper.GetString("tls-key")
+}
+
+// TLSSelfSigned indicates if HTTPS should be served with a generated, self-signed certificate.
+func (*Config) TLSSelfSigned() bool {
+	return viper.GetBool("tls-self-signed")
+}
+
+// TLSCAOut returns the location to write the PEM encoded certificate authority of the self-signed certificate to.
+func (*Config) TLSCAOut() string {
+	return viper.GetString("tls-ca-out")
+}
+
+// TLSPort returns the port to serve HTTPS on next to HTTP, when 0 HTTPS is served on the regular port instead.
+func (*Config) TLSPort() int {
+	return viper.GetInt("tls-port")
+}
+
+// TLSEnabled indicates if HTTPS should be served.
+func (config *Config) TLSEnabled() bool {
+	return config.TLSSelfSigned() || config.TLSCert() != "" || config.TLSKey() != ""
+}
+
+// CORSOrigins returns the origins that are allowed to use the server from a browser, CORS is disabled when empty.
+func (*Config) CORSOrigins() []string {
+	return stringSlice("cors-origins")
+}
+
+// CORSEchoOrigin indicates if the origin of the request should be echoed instead of responding with *.
+func (*Config) CORSEchoOrigin() bool {
+	return viper.GetBool("cors-echo-origin")
+}
+
+// CORSMethods returns the methods that are allowed from a browser, all supported methods when empty.
+func (*Config) CORSMethods() []string {
+	return stringSlice("cors-methods")
+}
+
+// CORSHeaders returns the request headers that are allowed from a browser, the requested headers when empty.
+func (*Config) CORSHeaders() []string {
+	return stringSlice("cors-headers")
+}
+
+// CORSExposedHeaders returns the response headers that are made available to a browser.
+func (*Config) CORSExposedHeaders() []string {
+	return stringSlice("cors-exposed-headers")
+}
+
+// CORSCredentials indicates if browsers may send credentials like cookies.
+func (*Config) CORSCredentials() bool {
+	return viper.GetBool("cors-credentials")
+}
+
+// CORSMaxAge returns how long browsers may cache the result of a preflight request.
+func (*Config) CORSMaxAge() time.Duration {
+	return durationOrDefault("cors-max-age", 10*time.Minute)
+}
+
+// stringSlice returns a list of values, which may be separated by commas when set as environment variable.
+func stringSlice(key string) []string {
+	var values []string
+	for _, value := range viper.GetStringSlice(key) {
+		for _, part := range strings.Split(value, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				values = append(values, part)
+			}
+		}
+	}
+	return values
+}
+
+func durationOrDefault(key string, defaultDuration time.Duration) time.Duration {
+	duration := viper.GetDuration(key)
+	if duration == 0 {
+		duration = defaultDuration
+	}
+	return duration
+}
+
 // initConfig reads in config file and ENV variables if set.
 func Initialize() {
 	if cfgFile != "" {
@@ -81,4 +351,92 @@ func InitializeRootFlags(rootCmd *cobra.Command) {
 	rootCmd.PersistentFlags().Bool("in-memory", false, "use in memory storage instead of file system")
 	viper.BindPFlag("in-memory", rootCmd.PersistentFlags().Lookup("in-memory"))
 	rootCmd.PersistentFlags().Lookup("in-memory").NoOptDefVal = "true"
+	rootCmd.PersistentFlags().String("host", "", "host name or IP address the HTTP Server binds to (default is all interfaces)")
+	viper.BindPFlag("host", rootCmd.PersistentFlags().Lookup("host"))
+	rootCmd.PersistentFlags().String("data-dir", "", "directory used for storage (default is ./data)")
+	viper.BindPFlag("data-dir", rootCmd.PersistentFlags().Lookup("data-dir"))
+	rootCmd.PersistentFlags().Bool("objects-only", false, "only store JSON objects, rejecting arrays, strings, numbers and null")
+	viper.BindPFlag("objects-only", rootCmd.PersistentFlags().Lookup("objects-only"))
+	rootCmd.PersistentFlags().Lookup("objects-only").NoOptDefVal = "true"
+	rootCmd.PersistentFlags().Bool("read-only", false, "reject requests that change documents with 405 Method Not Allowed")
+	viper.BindPFlag("read-only", rootCmd.PersistentFlags().Lookup("read-only"))
+	rootCmd.PersistentFlags().Lookup("read-only").NoOptDefVal = "true"
+	rootCmd.PersistentFlags().Duration("shutdown-timeout", 0, "time given to requests in progress to complete on shutdown (default is 30s)")
+	viper.BindPFlag("shutdown-timeout", rootCmd.PersistentFlags().Lookup("shutdown-timeout"))
+	rootCmd.PersistentFlags().Duration("read-timeout", 0, "maximum duration for reading a request (default is 30s)")
+	viper.BindPFlag("read-timeout", rootCmd.PersistentFlags().Lookup("read-timeout"))
+	rootCmd.PersistentFlags().Duration("write-timeout", 0, "maximum duration for writing a response (default is 1m)")
+	viper.BindPFlag("write-timeout", rootCmd.PersistentFlags().Lookup("write-timeout"))
+	rootCmd.PersistentFlags().Duration("idle-timeout", 0, "maximum duration to wait for the next request on a keep-alive connection (default is 2m)")
+	viper.BindPFlag("idle-timeout", rootCmd.PersistentFlags().Lookup("idle-timeout"))
+	rootCmd.PersistentFlags().Int("max-header-bytes", 0, "maximum size of request headers in bytes (default is 1MB)")
+	viper.BindPFlag("max-header-bytes", rootCmd.PersistentFlags().Lookup("max-header-bytes"))
+	rootCmd.PersistentFlags().Int("history-count", 0, "number of versions to keep in the history of each document (default is no history)")
+	viper.BindPFlag("history-count", rootCmd.PersistentFlags().Lookup("history-count"))
+	rootCmd.PersistentFlags().Duration("history-age", 0, "how long to keep versions in the history of each document (default is no history)")
+	viper.BindPFlag("history-age", rootCmd.PersistentFlags().Lookup("history-age"))
+	rootCmd.PersistentFlags().Bool("upsert", false, "replace items that already exist on POST, instead of responding with 409 Conflict")
+	viper.BindPFlag("upsert", rootCmd.PersistentFlags().Lookup("upsert"))
+	rootCmd.PersistentFlags().Lookup("upsert").NoOptDefVal = "true"
+	rootCmd.PersistentFlags().Duration("idempotency-window", 0, "how long responses to POST requests with an Idempotency-Key are remembered, 0 to disable (default is 24h)")
+	viper.BindPFlag("idempotency-window", rootCmd.PersistentFlags().Lookup("idempotency-window"))
+	rootCmd.PersistentFlags().String("id-field", "", "field that holds the id of objects, like _id or uuid (default is id)")
+	viper.BindPFlag("id-field", rootCmd.PersistentFlags().Lookup("id-field"))
+	rootCmd.PersistentFlags().String("id-strategy", "", "how ids are generated: random, uuid, ulid, sequence or slug:field (default is random)")
+	viper.BindPFlag("id-strategy", rootCmd.PersistentFlags().Lookup("id-strategy"))
+	rootCmd.PersistentFlags().StringSlice("id-strategies", nil, "how ids are generated below path prefixes, like /users=sequence")
+	viper.BindPFlag("id-strategies", rootCmd.PersistentFlags().Lookup("id-strategies"))
+	rootCmd.PersistentFlags().StringSlice("schemas", nil, "files with the JSON Schemas of the items in collections, like /users/*/roles=role.json")
+	viper.BindPFlag("schemas", rootCmd.PersistentFlags().Lookup("schemas"))
+	rootCmd.PersistentFlags().Bool("strict", false, "reject items for collections without JSON Schema")
+	viper.BindPFlag("strict", rootCmd.PersistentFlags().Lookup("strict"))
+	rootCmd.PersistentFlags().Lookup("strict").NoOptDefVal = "true"
+	rootCmd.PersistentFlags().String("created-at-field", "", "field maintained with when an object was first stored, like createdAt")
+	viper.BindPFlag("created-at-field", rootCmd.PersistentFlags().Lookup("created-at-field"))
+	rootCmd.PersistentFlags().String("updated-at-field", "", "field maintained with when an object was last stored, like updatedAt")
+	viper.BindPFlag("updated-at-field", rootCmd.PersistentFlags().Lookup("updated-at-field"))
+	rootCmd.PersistentFlags().String("version-field", "", "field maintained with how often an object was stored, like version")
+	viper.BindPFlag("version-field", rootCmd.PersistentFlags().Lookup("version-field"))
+	rootCmd.PersistentFlags().String("created-by-field", "", "field maintained with who first stored an object, like createdBy")
+	viper.BindPFlag("created-by-field", rootCmd.PersistentFlags().Lookup("created-by-field"))
+	rootCmd.PersistentFlags().String("timestamp-format", "", "format of managed timestamps: rfc3339, rfc3339nano, unix or unixmilli (default is rfc3339)")
+	viper.BindPFlag("timestamp-format", rootCmd.PersistentFlags().Lookup("timestamp-format"))
+	rootCmd.PersistentFlags().String("user-header", "", "request header that identifies who stores an object (default is Authorization)")
+	viper.BindPFlag("user-header", rootCmd.PersistentFlags().Lookup("user-header"))
+	rootCmd.PersistentFlags().Bool("reject-managed-fields", false, "reject requests that change managed fields instead of ignoring the changes")
+	viper.BindPFlag("reject-managed-fields", rootCmd.PersistentFlags().Lookup("reject-managed-fields"))
+	rootCmd.PersistentFlags().Lookup("reject-managed-fields").NoOptDefVal = "true"
+	rootCmd.PersistentFlags().Bool("managed-headers-only", false, "leave managed fields out of responses, only sending them as headers")
+	viper.BindPFlag("managed-headers-only", rootCmd.PersistentFlags().Lookup("managed-headers-only"))
+	rootCmd.PersistentFlags().Lookup("managed-headers-only").NoOptDefVal = "true"
+	rootCmd.PersistentFlags().StringSlice("cors-origins", nil, "origins allowed to use the server from a browser, * for any (default is CORS disabled)")
+	viper.BindPFlag("cors-origins", rootCmd.PersistentFlags().Lookup("cors-origins"))
+	rootCmd.PersistentFlags().Bool("cors-echo-origin", false, "respond with the origin of the request instead of *")
+	viper.BindPFlag("cors-echo-origin", rootCmd.PersistentFlags().Lookup("cors-echo-origin"))
+	rootCmd.PersistentFlags().Lookup("cors-echo-origin").NoOptDefVal = "true"
+	rootCmd.PersistentFlags().StringSlice("cors-methods", nil, "methods allowed from a browser (default is all supported methods)")
+	viper.BindPFlag("cors-methods", rootCmd.PersistentFlags().Lookup("cors-methods"))
+	rootCmd.PersistentFlags().StringSlice("cors-headers", nil, "request headers allowed from a browser (default is the requested headers)")
+	viper.BindPFlag("cors-headers", rootCmd.PersistentFlags().Lookup("cors-headers"))
+	rootCmd.PersistentFlags().StringSlice("cors-exposed-headers", nil, "response headers exposed to a browser (default is ETag, Link, Location, X-Total-Count, Preference-Applied, Idempotent-Replayed and the managed field headers)")
+	viper.BindPFlag("cors-exposed-headers", rootCmd.PersistentFlags().Lookup("cors-exposed-headers"))
+	rootCmd.PersistentFlags().Bool("cors-credentials", false, "allow browsers to send credentials like cookies")
+	viper.BindPFlag("cors-credentials", rootCmd.PersistentFlags().Lookup("cors-credentials"))
+	rootCmd.PersistentFlags().Lookup("cors-credentials").NoOptDefVal = "true"
+	rootCmd.PersistentFlags().Duration("cors-max-age", 0, "how long browsers may cache preflight results (default is 10m)")
+	viper.BindPFlag("cors-max-age", rootCmd.PersistentFlags().Lookup("cors-max-age"))
+}
+
+func InitializeServeFlags(serveCmd *cobra.Command) {
+	serveCmd.Flags().String("tls-cert", "", "PEM encoded certificate file to serve HTTPS with")
+	viper.BindPFlag("tls-cert", serveCmd.Flags().Lookup("tls-cert"))
+	serveCmd.Flags().String("tls-key", "", "PEM encoded private key file of the certificate to serve HTTPS with")
+	viper.BindPFlag("tls-key", serveCmd.Flags().Lookup("tls-key"))
+	serveCmd.Flags().Bool("tls-self-signed", false, "serve HTTPS with a generated certificate for localhost")
+	viper.BindPFlag("tls-self-signed", serveCmd.Flags().Lookup("tls-self-signed"))
+	serveCmd.Flags().Lookup("tls-self-signed").NoOptDefVal = "true"
+	serveCmd.Flags().String("tls-ca-out", "", "file to write the certificate authority of the self-signed certificate to")
+	viper.BindPFlag("tls-ca-out", serveCmd.Flags().Lookup("tls-ca-out"))
+	serveCmd.Flags().Int("tls-port", 0, "port number to serve HTTPS on, next to HTTP on the regular port (default is HTTPS only)")
+	viper.BindPFlag("tls-port", serveCmd.Flags().Lookup("tls-port"))
 }
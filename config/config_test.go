@@ -5,6 +5,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"os"
 	"testing"
+	"time"
 )
 
 func TestDefaultPortIs8080(t *testing.T) {
@@ -27,6 +28,144 @@ func TestPortCanBeSetWithEnvironmentVariable(t *testing.T) {
 	os.Setenv("LAZY_REST_PORT", "")
 }
 
+func TestDefaultHostIsEmpty(t *testing.T) {
+	config := New()
+	assert.Equal(t, "", config.Host())
+}
+
+func TestHostCanBeSetWithEnvironmentVariable(t *testing.T) {
+	os.Setenv("LAZY_REST_HOST", "127.0.0.1")
+	Initialize()
+	config := New()
+	assert.Equal(t, "127.0.0.1", config.Host())
+	os.Setenv("LAZY_REST_HOST", "")
+}
+
+func TestDefaultDataDirIsData(t *testing.T) {
+	config := New()
+	assert.Equal(t, "./data", config.DataDir())
+}
+
+func TestDataDirCanBeSetWithViper(t *testing.T) {
+	viper.Set("data-dir", "/data")
+	config := New()
+	assert.Equal(t, "/data", config.DataDir())
+	viper.Set("data-dir", nil)
+}
+
+func TestDataDirCanBeSetWithEnvironmentVariable(t *testing.T) {
+	os.Setenv("LAZY_REST_DATA_DIR", "/tmp/lazy-rest")
+	Initialize()
+	config := New()
+	assert.Equal(t, "/tmp/lazy-rest", config.DataDir())
+	os.Setenv("LAZY_REST_DATA_DIR", "")
+}
+
+func TestDefaultShutdownTimeoutIs30Seconds(t *testing.T) {
+	config := New()
+	assert.Equal(t, 30*time.Second, config.ShutdownTimeout())
+}
+
+func TestShutdownTimeoutCanBeSetWithEnvironmentVariable(t *testing.T) {
+	os.Setenv("LAZY_REST_SHUTDOWN_TIMEOUT", "5s")
+	Initialize()
+	config := New()
+	assert.Equal(t, 5*time.Second, config.ShutdownTimeout())
+	os.Setenv("LAZY_REST_SHUTDOWN_TIMEOUT", "")
+}
+
+func TestReadTimeoutCanBeSetWithViper(t *testing.T) {
+	viper.Set("read-timeout", "10s")
+	config := New()
+	assert.Equal(t, 10*time.Second, config.ReadTimeout())
+	viper.Set("read-timeout", nil)
+}
+
+func TestDefaultMaxHeaderBytesIs1MB(t *testing.T) {
+	config := New()
+	assert.Equal(t, 1<<20, config.MaxHeaderBytes())
+}
+
+func TestTLSIsDisabledByDefault(t *testing.T) {
+	config := New()
+	assert.Equal(t, false, config.TLSEnabled())
+}
+
+func TestTLSIsEnabledWhenSelfSigned(t *testing.T) {
+	viper.Set("tls-self-signed", true)
+	config := New()
+	assert.Equal(t, true, config.TLSEnabled())
+	viper.Set("tls-self-signed", nil)
+}
+
+func TestHistoryIsDisabledByDefault(t *testing.T) {
+	config := New()
+	assert.Equal(t, false, config.HistoryEnabled())
+}
+
+func TestHistoryIsEnabledWithAge(t *testing.T) {
+	viper.Set("history-age", "24h")
+	config := New()
+	assert.Equal(t, true, config.HistoryEnabled())
+	assert.Equal(t, 24*time.Hour, config.HistoryAge())
+	viper.Set("history-age", nil)
+}
+
+func TestDefaultTimestampFormat(t *testing.T) {
+	config := New()
+	assert.Equal(t, "rfc3339", config.TimestampFormat())
+	assert.Equal(t, false, config.ManagedFieldsEnabled())
+}
+
+func TestManagedFieldsAreEnabledWithAField(t *testing.T) {
+	viper.Set("updated-at-field", "updatedAt")
+	config := New()
+	assert.Equal(t, true, config.ManagedFieldsEnabled())
+	viper.Set("updated-at-field", nil)
+}
+
+func TestDefaultIDs(t *testing.T) {
+	config := New()
+	assert.Equal(t, "id", config.IDField())
+	assert.Equal(t, "random", config.IDStrategy())
+	assert.Empty(t, config.IDStrategies())
+}
+
+func TestDefaultIdempotencyWindow(t *testing.T) {
+	config := New()
+	assert.Equal(t, 24*time.Hour, config.IdempotencyWindow())
+}
+
+func TestIdempotencyWindowCanBeDisabled(t *testing.T) {
+	os.Setenv("LAZY_REST_IDEMPOTENCY_WINDOW", "0")
+	Initialize()
+	config := New()
+	assert.Equal(t, time.Duration(0), config.IdempotencyWindow(), "A window of 0 should disable idempotency keys")
+	os.Setenv("LAZY_REST_IDEMPOTENCY_WINDOW", "")
+}
+
+func TestIDStrategiesPerPrefix(t *testing.T) {
+	viper.Set("id-strategies", []string{"/users=sequence", "posts = slug:title"})
+	config := New()
+	assert.Equal(t, map[string]string{"/users": "sequence", "posts": "slug:title"}, config.IDStrategies())
+	viper.Set("id-strategies", nil)
+}
+
+func TestSchemasPerPattern(t *testing.T) {
+	viper.Set("schemas", []string{"/users=schemas/user.json", "/users/*/roles = schemas/role.json", "invalid"})
+	config := New()
+	assert.Equal(t, map[string]string{"/users": "schemas/user.json", "/users/*/roles": "schemas/role.json"}, config.Schemas())
+	viper.Set("schemas", nil)
+}
+
+func TestCORSOriginsCanBeSetWithEnvironmentVariable(t *testing.T) {
+	os.Setenv("LAZY_REST_CORS_ORIGINS", "http://localhost:3000, https://*.example.com")
+	Initialize()
+	config := New()
+	assert.Equal(t, []string{"http://localhost:3000", "https://*.example.com"}, config.CORSOrigins())
+	os.Setenv("LAZY_REST_CORS_ORIGINS", "")
+}
+
 func TestDefaultInMemoryIsFalse(t *testing.T) {
 	config := New()
 	assert.Equal(t, false, config.InMemory())
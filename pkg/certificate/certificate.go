@@ -0,0 +1,125 @@
+/*
+Copyright © 2020 Arnoud Kleinloog
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package certificate
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"time"
+)
+
+// SelfSigned is a certificate authority that only lives in memory, together with a certificate it issued for serving TLS.
+type SelfSigned struct {
+	// CertificateAuthority is the PEM encoded certificate of the authority, which clients can add to their trusted certificates.
+	CertificateAuthority []byte
+	// Certificate is the certificate issued by the authority, including its private key.
+	Certificate tls.Certificate
+}
+
+// GenerateSelfSigned creates a certificate authority and a certificate for localhost and the hosts, which can be host names or IP addresses.
+func GenerateSelfSigned(hosts ...string) (*SelfSigned, error) {
+
+	now := time.Now()
+
+	authorityKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	authorityTemplate := &x509.Certificate{
+		Subject:               pkix.Name{Organization: []string{"Lazy REST"}, CommonName: "Lazy REST Development CA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+
+	authorityTemplate.SerialNumber, err = serialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	authorityDER, err := x509.CreateCertificate(rand.Reader, authorityTemplate, authorityTemplate, &authorityKey.PublicKey, authorityKey)
+	if err != nil {
+		return nil, err
+	}
+
+	authority, err := x509.ParseCertificate(authorityDER)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		Subject:     pkix.Name{Organization: []string{"Lazy REST"}, CommonName: "localhost"},
+		NotBefore:   now.Add(-time.Hour),
+		NotAfter:    now.AddDate(1, 0, 0),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	template.SerialNumber, err = serialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, host := range append([]string{"localhost", "127.0.0.1", "::1"}, hosts...) {
+		if host == "" {
+			continue
+		}
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	certificateDER, err := x509.CreateCertificate(rand.Reader, template, authority, &key.PublicKey, authorityKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SelfSigned{
+		CertificateAuthority: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: authorityDER}),
+		Certificate: tls.Certificate{
+			Certificate: [][]byte{certificateDER, authorityDER},
+			PrivateKey:  key,
+		},
+	}, nil
+}
+
+// WriteCertificateAuthority writes the PEM encoded certificate of the authority to a file, so it can be trusted by clients.
+func (selfSigned *SelfSigned) WriteCertificateAuthority(location string) error {
+	return ioutil.WriteFile(location, selfSigned.CertificateAuthority, 0644)
+}
+
+func serialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
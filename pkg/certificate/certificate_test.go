@@ -0,0 +1,31 @@
+package certificate
+
+import (
+	"crypto/x509"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSelfSignedCertificateIsTrustedByItsAuthority(t *testing.T) {
+
+	selfSigned, err := GenerateSelfSigned("lazy-rest.local", "10.0.0.1")
+	if !assert.NoError(t, err, "Error occurred while generating certificate") {
+		return
+	}
+
+	roots := x509.NewCertPool()
+	assert.True(t, roots.AppendCertsFromPEM(selfSigned.CertificateAuthority), "Authority is not valid PEM")
+
+	leaf, err := x509.ParseCertificate(selfSigned.Certificate.Certificate[0])
+	if !assert.NoError(t, err, "Error occurred while parsing certificate") {
+		return
+	}
+
+	for _, host := range []string{"localhost", "127.0.0.1", "lazy-rest.local", "10.0.0.1"} {
+		_, err = leaf.Verify(x509.VerifyOptions{DNSName: host, Roots: roots})
+		assert.NoError(t, err, "Certificate is not valid for "+host)
+	}
+
+	_, err = leaf.Verify(x509.VerifyOptions{DNSName: "example.com", Roots: roots})
+	assert.Error(t, err, "Certificate should not be valid for other hosts")
+}
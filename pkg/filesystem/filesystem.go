@@ -1,80 +1,156 @@
 package filesystem
 
 import (
-	"github.com/akleinloog/lazy-rest/config"
 	"github.com/spf13/afero"
 	"os"
 	"path"
+	"path/filepath"
+	"strings"
+	"time"
 )
 
-var (
-	_fs           afero.Fs
-	configuration *config.Config
-)
-
+// Fs provides access to the files in an underlying afero file system.
 type Fs struct {
+	fs afero.Fs
+}
+
+// New returns a file system on top of the afero file system.
+func New(fs afero.Fs) Fs {
+	return Fs{fs: fs}
+}
+
+// NewOsFs returns a file system that stores files in a directory of the operating system.
+func NewOsFs(directory string) Fs {
+	return New(afero.NewBasePathFs(afero.NewOsFs(), directory))
 }
 
-// New returns the file system.
-func New(config *config.Config) Fs {
-	configuration = config
-	return Fs{}
+// NewMemFs returns a file system that keeps files in memory.
+func NewMemFs() Fs {
+	return New(afero.NewMemMapFs())
 }
 
 // Exists indicates if a location exists on the file system (could be a file or a directory).
-func (*Fs) Exists(location string) (bool, error) {
-	return afero.Exists(fs(), location)
+func (f *Fs) Exists(location string) (bool, error) {
+	return afero.Exists(f.fs, location)
 }
 
 // IsDir indicates if a location is a directory or not.
-func (*Fs) IsDir(location string) (bool, error) {
-	return afero.IsDir(fs(), location)
+func (f *Fs) IsDir(location string) (bool, error) {
+	return afero.IsDir(f.fs, location)
 }
 
 // DirExists indicates if a directory exists or not.
-func (*Fs) DirExists(location string) (bool, error) {
-	return afero.DirExists(fs(), location)
+func (f *Fs) DirExists(location string) (bool, error) {
+	return afero.DirExists(f.fs, location)
+}
+
+// ModTime returns when a file was last modified.
+func (f *Fs) ModTime(location string) (time.Time, error) {
+	info, err := f.fs.Stat(location)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
 }
 
 // ReadFile returns the content of a file.
-func (*Fs) ReadFile(location string) ([]byte, error) {
-	return afero.ReadFile(fs(), location)
+func (f *Fs) ReadFile(location string) ([]byte, error) {
+	return afero.ReadFile(f.fs, location)
 }
 
-func (*Fs) ReadDir(location string) ([]os.FileInfo, error) {
-	return afero.ReadDir(fs(), location)
+// ReadDir returns the files and directories in a directory.
+func (f *Fs) ReadDir(location string) ([]os.FileInfo, error) {
+	return afero.ReadDir(f.fs, location)
 }
 
-func (*Fs) WriteFile(location string, data []byte) error {
+// tempMarker is part of the names of temporary files, which start with a dot so they are hidden.
+const tempMarker = ".tmp-"
+
+// IsTempFile indicates if a file name is that of a temporary file, which remains after a crash while writing.
+func IsTempFile(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.Contains(name, tempMarker)
+}
+
+// WriteFile writes data to a file, creating the directory it is in when needed. The data is written to a temporary
+// file that is synced to disk before it replaces the file, so after a crash the file holds either the old or the new data.
+func (f *Fs) WriteFile(location string, data []byte) error {
 
 	var directory = path.Dir(location)
 
-	exists, err := afero.DirExists(fs(), directory)
+	exists, err := afero.DirExists(f.fs, directory)
 	if err != nil {
 		return err
 	}
 
 	if !exists {
-		err = fs().MkdirAll(directory, 0777)
+		err = f.fs.MkdirAll(directory, 0777)
 		if err != nil {
 			return err
 		}
 	}
 
-	return afero.WriteFile(fs(), location, data, 0644)
+	file, err := afero.TempFile(f.fs, directory, "."+path.Base(location)+tempMarker)
+	if err != nil {
+		return err
+	}
+	temporary := path.Join(directory, path.Base(file.Name()))
+
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = f.fs.Chmod(temporary, 0644)
+	}
+	if err != nil {
+		f.fs.Remove(temporary)
+		return err
+	}
+
+	return f.Rename(temporary, location)
 }
 
-func (*Fs) Remove(location string) error {
-	return fs().Remove(location)
+// Rename moves a file to another location, replacing what is there.
+// The directory is synced, so the rename is not lost in a crash.
+func (f *Fs) Rename(location string, newLocation string) error {
+
+	err := f.fs.Rename(location, newLocation)
+	if err != nil {
+		return err
+	}
+
+	return f.syncDir(path.Dir(newLocation))
 }
 
-func fs() afero.Fs {
-	if _fs == nil {
-		if configuration.InMemory() {
-			_fs = afero.NewMemMapFs()
-		} else {
-			_fs = afero.NewBasePathFs(afero.NewOsFs(), "./data")
-		}
+// syncDir syncs a directory to disk, which makes changes to the files in it durable.
+func (f *Fs) syncDir(location string) error {
+
+	directory, err := f.fs.Open(location)
+	if err != nil {
+		return err
 	}
-	return _fs
+	defer directory.Close()
+
+	// Not every operating system supports syncing directories, the rename itself is atomic regardless
+	directory.Sync()
+
+	return nil
+}
+
+// Walk walks the files and directories below a location, in lexical order.
+func (f *Fs) Walk(location string, walk filepath.WalkFunc) error {
+	return afero.Walk(f.fs, location, walk)
+}
+
+// MkdirAll creates a directory, together with any missing parents.
+func (f *Fs) MkdirAll(location string) error {
+	return f.fs.MkdirAll(location, 0777)
+}
+
+// Remove removes a file or an empty directory.
+func (f *Fs) Remove(location string) error {
+	return f.fs.Remove(location)
 }
@@ -1,8 +1,6 @@
 package filesystem
 
 import (
-	"github.com/akleinloog/lazy-rest/config"
-	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 	"os"
 	"path"
@@ -11,8 +9,7 @@ import (
 
 func TestWithRealFileSystem(t *testing.T) {
 
-	configuration := config.New()
-	fs := New(&configuration)
+	fs := NewOsFs("./data")
 
 	content := "Hello"
 	location := "tests/case-001"
@@ -25,16 +22,37 @@ func TestWithRealFileSystem(t *testing.T) {
 
 func TestWithInMemoryFileSystem(t *testing.T) {
 
-	viper.Set("in-memory", true)
-	configuration := config.New()
-	fs := New(&configuration)
+	fs := NewMemFs()
 
 	content := "Hello"
 	location := "tests/case-001"
 
 	WriteReadAndRemoveFile(t, fs, location, content)
+}
+
+func TestWriteFileReplacesAtomically(t *testing.T) {
+
+	fs := NewMemFs()
+
+	assert.NoError(t, fs.WriteFile("tests/case-001", []byte("Hello")))
+	assert.NoError(t, fs.WriteFile("tests/case-001", []byte("Bye")))
+
+	bytes, err := fs.ReadFile("tests/case-001")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Bye", string(bytes))
+	}
+
+	files, err := fs.ReadDir("tests")
+	if assert.NoError(t, err) && assert.Len(t, files, 1, "No temporary files should remain") {
+		assert.Equal(t, "case-001", files[0].Name())
+		assert.Equal(t, os.FileMode(0644), files[0].Mode().Perm())
+	}
+}
 
-	viper.Set("in-memory", nil)
+func TestIsTempFile(t *testing.T) {
+	assert.True(t, IsTempFile(".case-001.tmp-123456"))
+	assert.False(t, IsTempFile("case-001.tmp-123456"))
+	assert.False(t, IsTempFile(".case-001.meta"))
 }
 
 func WriteReadAndRemoveFile(t *testing.T, fs Fs, location string, content string) {
@@ -0,0 +1,218 @@
+/*
+Copyright © 2020 Arnoud Kleinloog
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package format
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// csvId is the column holding the id, which comes first and is always read as string.
+	csvId = "id"
+	// csvValue is the column holding values that are not objects.
+	csvValue = "value"
+)
+
+// encodeCSV writes content as CSV with a row per item, or a single row when it is not an array.
+// Fields of nested objects get a column with a dotted header, arrays are written as JSON.
+func encodeCSV(writer io.Writer, content interface{}) error {
+
+	items, isArray := content.([]interface{})
+	if !isArray {
+		items = []interface{}{content}
+	}
+
+	rows := make([]map[string]string, 0, len(items))
+	columns := make(map[string]bool)
+
+	for _, item := range items {
+		row := make(map[string]string)
+		if object, isObject := item.(map[string]interface{}); isObject {
+			err := flatten("", object, row)
+			if err != nil {
+				return err
+			}
+		} else {
+			cell, err := csvCell(item)
+			if err != nil {
+				return err
+			}
+			row[csvValue] = cell
+		}
+		for column := range row {
+			columns[column] = true
+		}
+		rows = append(rows, row)
+	}
+
+	header := make([]string, 0, len(columns))
+	for column := range columns {
+		header = append(header, column)
+	}
+	sort.Slice(header, func(i, j int) bool {
+		if header[i] == csvId || header[j] == csvId {
+			return header[i] == csvId
+		}
+		return header[i] < header[j]
+	})
+
+	csvWriter := csv.NewWriter(writer)
+	err := csvWriter.Write(header)
+	if err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		record := make([]string, len(header))
+		for index, column := range header {
+			record[index] = row[column]
+		}
+		err = csvWriter.Write(record)
+		if err != nil {
+			return err
+		}
+	}
+
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+// flatten adds the fields of an object to a row, prefixing the columns of nested fields with their parent.
+func flatten(prefix string, object map[string]interface{}, row map[string]string) error {
+
+	for key, value := range object {
+		column := key
+		if prefix != "" {
+			column = prefix + "." + key
+		}
+		if nested, isObject := value.(map[string]interface{}); isObject && len(nested) > 0 {
+			err := flatten(column, nested, row)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		cell, err := csvCell(value)
+		if err != nil {
+			return err
+		}
+		row[column] = cell
+	}
+
+	return nil
+}
+
+// csvCell returns the text of a cell, strings are written as they are, other values as JSON, and null as empty cell.
+func csvCell(value interface{}) (string, error) {
+
+	switch typed := value.(type) {
+	case string:
+		return typed, nil
+	case nil:
+		return "", nil
+	default:
+		bytes, err := json.Marshal(typed)
+		return string(bytes), err
+	}
+}
+
+// decodeCSV reads CSV with a header into an array of objects. Dotted headers become nested fields, empty cells
+// are skipped, and cells holding a JSON number, boolean, array or object are read as such, except for the id.
+func decodeCSV(body []byte) (interface{}, error) {
+
+	records, err := csv.NewReader(bytes.NewReader(body)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]interface{}, 0, len(records))
+	if len(records) == 0 {
+		return items, nil
+	}
+
+	header := records[0]
+	for line, record := range records[1:] {
+		item := make(map[string]interface{})
+		for index, cell := range record {
+			if cell == "" {
+				continue
+			}
+			err = setField(item, strings.Split(header[index], "."), csvValueOf(header[index], cell))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line+2, err)
+			}
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// csvValueOf returns the value of a cell in a column.
+func csvValueOf(column string, cell string) interface{} {
+
+	if column == csvId {
+		return cell
+	}
+
+	trimmed := strings.TrimSpace(cell)
+	if trimmed == "true" || trimmed == "false" || strings.HasPrefix(trimmed, "[") || strings.HasPrefix(trimmed, "{") {
+		var value interface{}
+		if json.Unmarshal([]byte(trimmed), &value) == nil {
+			return value
+		}
+	}
+
+	if number, err := strconv.ParseFloat(trimmed, 64); err == nil && json.Valid([]byte(trimmed)) {
+		return number
+	}
+
+	return cell
+}
+
+// setField sets a nested field of an object, creating the objects along the path.
+func setField(object map[string]interface{}, path []string, value interface{}) error {
+
+	for _, key := range path[:len(path)-1] {
+		existing, present := object[key]
+		if !present {
+			nested := make(map[string]interface{})
+			object[key] = nested
+			object = nested
+			continue
+		}
+		nested, isObject := existing.(map[string]interface{})
+		if !isObject {
+			return fmt.Errorf("field `%s` is both a value and an object", strings.Join(path, "."))
+		}
+		object = nested
+	}
+
+	last := path[len(path)-1]
+	if _, present := object[last]; present {
+		return fmt.Errorf("field `%s` occurs more than once", strings.Join(path, "."))
+	}
+	object[last] = value
+
+	return nil
+}
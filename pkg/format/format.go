@@ -0,0 +1,295 @@
+/*
+Copyright © 2020 Arnoud Kleinloog
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package format
+
+import (
+	"bytes"
+	"encoding/json"
+	"gopkg.in/yaml.v3"
+	"io"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Format is a representation of documents, that responses can be written in and requests can be read from.
+type Format struct {
+	// Name selects the format with the format query parameter.
+	Name string
+	// MediaType is the media type that selects the format, next to its aliases.
+	MediaType string
+	// ContentType is the content type of responses in the format.
+	ContentType string
+	aliases     []string
+	encode      func(writer io.Writer, content interface{}) error
+	decode      func(body []byte) (interface{}, error)
+}
+
+var (
+	// JSON is the default format.
+	JSON = &Format{Name: "json", MediaType: "application/json", ContentType: "application/json",
+		encode: encodeJSON, decode: decodeJSON}
+	// PrettyJSON is JSON that is indented to make it readable, it can only be selected with the format query parameter.
+	PrettyJSON = &Format{Name: "pretty", MediaType: "application/json", ContentType: "application/json",
+		encode: encodePrettyJSON, decode: decodeJSON}
+	// YAML represents documents as YAML.
+	YAML = &Format{Name: "yaml", MediaType: "application/yaml", ContentType: "application/yaml",
+		aliases: []string{"application/x-yaml", "text/yaml", "text/x-yaml"}, encode: encodeYAML, decode: decodeYAML}
+	// XML represents documents as XML, with a type attribute for values that are not strings.
+	XML = &Format{Name: "xml", MediaType: "application/xml", ContentType: "application/xml; charset=utf-8",
+		aliases: []string{"text/xml"}, encode: encodeXML, decode: decodeXML}
+	// CSV represents documents as rows, nested fields are flattened into columns with dotted headers.
+	CSV = &Format{Name: "csv", MediaType: "text/csv", ContentType: "text/csv; charset=utf-8",
+		encode: encodeCSV, decode: decodeCSV}
+	// NDJSON represents documents as JSON, one per line.
+	NDJSON = &Format{Name: "ndjson", MediaType: "application/x-ndjson", ContentType: "application/x-ndjson",
+		aliases: []string{"application/jsonl", "application/jsonlines"}, encode: encodeNDJSON, decode: decodeNDJSON}
+
+	// All holds the supported formats, in order of preference.
+	All = []*Format{JSON, PrettyJSON, YAML, XML, CSV, NDJSON}
+)
+
+// Encode writes the content in the format.
+func (format *Format) Encode(writer io.Writer, content interface{}) error {
+	return format.encode(writer, content)
+}
+
+// Decode reads content in the format, the result holds the same types as content decoded from JSON.
+func (format *Format) Decode(body []byte) (interface{}, error) {
+	return format.decode(body)
+}
+
+// Names returns the names of all formats, for use in error messages.
+func Names() []string {
+	names := make([]string, 0, len(All))
+	for _, format := range All {
+		names = append(names, format.Name)
+	}
+	return names
+}
+
+// ByName returns the format with the name, or nil when there is none.
+func ByName(name string) *Format {
+	for _, format := range All {
+		if strings.EqualFold(format.Name, name) {
+			return format
+		}
+	}
+	return nil
+}
+
+// ForMediaType returns the format that reads and writes the media type, or nil when there is none.
+// Structured syntax suffixes like +json, +xml and +yaml select the format of their suffix.
+func ForMediaType(mediaType string) *Format {
+
+	mediaType = strings.ToLower(mediaType)
+
+	for _, format := range All {
+		if format.MediaType == mediaType {
+			return format
+		}
+		for _, alias := range format.aliases {
+			if alias == mediaType {
+				return format
+			}
+		}
+	}
+
+	switch {
+	case strings.HasSuffix(mediaType, "+json"):
+		return JSON
+	case strings.HasSuffix(mediaType, "+xml"):
+		return XML
+	case strings.HasSuffix(mediaType, "+yaml"):
+		return YAML
+	}
+
+	return nil
+}
+
+// mediaRange is a media range of an Accept header, with its quality.
+type mediaRange struct {
+	mediaType string
+	quality   float64
+}
+
+// Negotiate returns the format that is preferred by an Accept header, or nil when none of the formats is acceptable.
+// Without an Accept header, JSON is returned.
+func Negotiate(accept string) *Format {
+
+	if strings.TrimSpace(accept) == "" {
+		return JSON
+	}
+
+	ranges := parseAccept(accept)
+	excluded := make(map[*Format]bool)
+	for _, current := range ranges {
+		if format := ForMediaType(current.mediaType); format != nil && current.quality == 0 {
+			excluded[format] = true
+		}
+	}
+
+	for _, current := range ranges {
+		if current.quality == 0 {
+			continue
+		}
+		for _, format := range All {
+			if format != PrettyJSON && !excluded[format] && format.matches(current.mediaType) {
+				return format
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseAccept parses the media ranges of an Accept header, ordered by quality.
+func parseAccept(accept string) []mediaRange {
+
+	var ranges []mediaRange
+
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, present := params["q"]; present {
+			quality, err = strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+		}
+		ranges = append(ranges, mediaRange{mediaType: mediaType, quality: quality})
+	}
+
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].quality > ranges[j].quality
+	})
+
+	return ranges
+}
+
+// matches indicates if the format matches a media range, which can hold wildcards like */* and text/*.
+func (format *Format) matches(mediaRange string) bool {
+
+	if mediaRange == "*/*" {
+		return true
+	}
+
+	if strings.HasSuffix(mediaRange, "/*") {
+		prefix := strings.TrimSuffix(mediaRange, "*")
+		if strings.HasPrefix(format.MediaType, prefix) {
+			return true
+		}
+		for _, alias := range format.aliases {
+			if strings.HasPrefix(alias, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return ForMediaType(mediaRange) == format
+}
+
+func encodeJSON(writer io.Writer, content interface{}) error {
+	return json.NewEncoder(writer).Encode(content)
+}
+
+func encodePrettyJSON(writer io.Writer, content interface{}) error {
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(content)
+}
+
+func decodeJSON(body []byte) (interface{}, error) {
+	var content interface{}
+	err := json.Unmarshal(body, &content)
+	return content, err
+}
+
+func encodeYAML(writer io.Writer, content interface{}) error {
+	encoder := yaml.NewEncoder(writer)
+	encoder.SetIndent(2)
+	err := encoder.Encode(content)
+	if err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// decodeYAML reads YAML, and converts it to the types that JSON decodes into by way of JSON.
+func decodeYAML(body []byte) (interface{}, error) {
+
+	var content interface{}
+	err := yaml.Unmarshal(body, &content)
+	if err != nil {
+		return nil, err
+	}
+
+	return normalize(content)
+}
+
+// normalize converts content to the types that JSON decodes into, like float64 for all numbers.
+func normalize(content interface{}) (interface{}, error) {
+
+	bytes, err := json.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeJSON(bytes)
+}
+
+func encodeNDJSON(writer io.Writer, content interface{}) error {
+
+	items, isArray := content.([]interface{})
+	if !isArray {
+		items = []interface{}{content}
+	}
+
+	encoder := json.NewEncoder(writer)
+	for _, item := range items {
+		err := encoder.Encode(item)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// decodeNDJSON reads JSON values, one per line, into an array. Empty lines are skipped.
+func decodeNDJSON(body []byte) (interface{}, error) {
+
+	items := make([]interface{}, 0)
+
+	for _, line := range bytes.Split(body, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		item, err := decodeJSON(line)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
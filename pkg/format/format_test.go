@@ -0,0 +1,116 @@
+package format
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+var document = map[string]interface{}{
+	"id":    "1",
+	"name":  "Something",
+	"price": 12.5,
+	"sale":  true,
+	"notes": nil,
+	"tags":  []interface{}{"red", "blue"},
+	"owner": map[string]interface{}{"name": "Alice", "address": map[string]interface{}{"city": "Bern"}},
+	"a b":   "not a valid element name",
+}
+
+func TestNegotiate(t *testing.T) {
+
+	tests := []struct {
+		accept   string
+		expected *Format
+	}{
+		{"", JSON},
+		{"*/*", JSON},
+		{"application/json", JSON},
+		{"application/yaml", YAML},
+		{"text/xml", XML},
+		{"text/csv;q=0.5, application/x-ndjson", NDJSON},
+		{"text/html, application/xhtml+xml, application/xml;q=0.9, */*;q=0.8", XML},
+		{"application/json;q=0, */*", YAML},
+		{"application/vnd.api+json", JSON},
+		{"text/*", YAML},
+		{"image/png", nil},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, Negotiate(test.accept), "Unexpected format for `%s`", test.accept)
+	}
+}
+
+func TestByName(t *testing.T) {
+
+	assert.Equal(t, PrettyJSON, ByName("pretty"))
+	assert.Equal(t, CSV, ByName("CSV"))
+	assert.Nil(t, ByName("html"))
+}
+
+func TestRoundTrip(t *testing.T) {
+
+	for _, format := range []*Format{JSON, PrettyJSON, YAML, XML, NDJSON} {
+
+		var buffer bytes.Buffer
+		err := format.Encode(&buffer, []interface{}{document, "plain", 42.0})
+		if !assert.NoError(t, err, "Error occurred while encoding %s", format.Name) {
+			continue
+		}
+
+		decoded, err := format.Decode(buffer.Bytes())
+		if assert.NoError(t, err, "Error occurred while decoding %s", format.Name) {
+			assert.Equal(t, []interface{}{document, "plain", 42.0}, decoded, "Content changed in %s", format.Name)
+		}
+	}
+}
+
+func TestXML(t *testing.T) {
+
+	var buffer bytes.Buffer
+	err := XML.Encode(&buffer, map[string]interface{}{"id": "1", "count": 2.0, "a b": "c"})
+	if assert.NoError(t, err, "Error occurred while encoding XML") {
+		assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<document type="object">
+  <entry key="a b">c</entry>
+  <count type="number">2</count>
+  <id>1</id>
+</document>
+`, buffer.String())
+	}
+
+	decoded, err := XML.Decode([]byte(`<order><id>7</id><line>a</line><line>b</line><customer><name>Bob</name></customer></order>`))
+	if assert.NoError(t, err, "Error occurred while decoding XML without types") {
+		assert.Equal(t, map[string]interface{}{
+			"id":       "7",
+			"line":     []interface{}{"a", "b"},
+			"customer": map[string]interface{}{"name": "Bob"},
+		}, decoded)
+	}
+
+	_, err = XML.Decode([]byte(`<document><price type="number">cheap</price></document>`))
+	assert.Error(t, err, "Invalid numbers should not be accepted")
+}
+
+func TestCSV(t *testing.T) {
+
+	var buffer bytes.Buffer
+	err := CSV.Encode(&buffer, []interface{}{
+		map[string]interface{}{"id": "1", "name": "First", "owner": map[string]interface{}{"name": "Alice"}},
+		map[string]interface{}{"id": "2", "price": 10.0, "tags": []interface{}{"red"}},
+	})
+	if assert.NoError(t, err, "Error occurred while encoding CSV") {
+		assert.Equal(t, "id,name,owner.name,price,tags\n1,First,Alice,,\n2,,,10,\"[\"\"red\"\"]\"\n", buffer.String())
+	}
+
+	decoded, err := CSV.Decode(buffer.Bytes())
+	if assert.NoError(t, err, "Error occurred while decoding CSV") {
+		assert.Equal(t, []interface{}{
+			map[string]interface{}{"id": "1", "name": "First", "owner": map[string]interface{}{"name": "Alice"}},
+			map[string]interface{}{"id": "2", "price": 10.0, "tags": []interface{}{"red"}},
+		}, decoded)
+	}
+
+	_, err = CSV.Decode([]byte("owner,owner.name\nAlice,Bob\n"))
+	assert.Error(t, err, "A field can not be both a value and an object")
+}
@@ -0,0 +1,289 @@
+/*
+Copyright © 2020 Arnoud Kleinloog
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package format
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// The root element of an XML document, and the elements of the items in an array.
+const (
+	xmlRoot = "document"
+	xmlItem = "item"
+	// xmlEntry holds a field whose name is not a valid XML name, the name is in its key attribute.
+	xmlEntry = "entry"
+)
+
+// encodeXML writes content as XML. Objects become elements with an element per field, arrays have an item
+// element per value. Values that are not strings are marked with a type attribute, so they can be read back.
+func encodeXML(writer io.Writer, content interface{}) error {
+
+	_, err := io.WriteString(writer, xml.Header)
+	if err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(writer)
+	encoder.Indent("", "  ")
+
+	err = writeElement(encoder, xmlRoot, content)
+	if err != nil {
+		return err
+	}
+
+	err = encoder.Flush()
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(writer, "\n")
+	return err
+}
+
+// writeElement writes a value as element with the name.
+func writeElement(encoder *xml.Encoder, name string, value interface{}) error {
+
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	if !isXMLName(name) {
+		start.Name.Local = xmlEntry
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "key"}, Value: name})
+	}
+
+	setType := func(valueType string) {
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "type"}, Value: valueType})
+	}
+
+	var text string
+
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		setType("object")
+		err := encoder.EncodeToken(start)
+		if err != nil {
+			return err
+		}
+		keys := make([]string, 0, len(typed))
+		for key := range typed {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			err = writeElement(encoder, key, typed[key])
+			if err != nil {
+				return err
+			}
+		}
+		return encoder.EncodeToken(start.End())
+	case []interface{}:
+		setType("array")
+		err := encoder.EncodeToken(start)
+		if err != nil {
+			return err
+		}
+		for _, item := range typed {
+			err = writeElement(encoder, xmlItem, item)
+			if err != nil {
+				return err
+			}
+		}
+		return encoder.EncodeToken(start.End())
+	case string:
+		text = typed
+	case bool:
+		setType("boolean")
+		text = strconv.FormatBool(typed)
+	case nil:
+		setType("null")
+	default:
+		setType("number")
+		bytes, err := json.Marshal(typed)
+		if err != nil {
+			return err
+		}
+		text = string(bytes)
+	}
+
+	err := encoder.EncodeToken(start)
+	if err != nil {
+		return err
+	}
+	if text != "" {
+		err = encoder.EncodeToken(xml.CharData(text))
+		if err != nil {
+			return err
+		}
+	}
+	return encoder.EncodeToken(start.End())
+}
+
+// isXMLName indicates if a field name can be used as element name.
+func isXMLName(name string) bool {
+
+	if name == "" || strings.HasPrefix(strings.ToLower(name), "xml") {
+		return false
+	}
+
+	for index, character := range name {
+		switch {
+		case unicode.IsLetter(character) || character == '_':
+		case index > 0 && (unicode.IsDigit(character) || character == '-' || character == '.'):
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// xmlNode is an element that is read from XML.
+type xmlNode struct {
+	name      string
+	key       string
+	valueType string
+	text      strings.Builder
+	children  []*xmlNode
+}
+
+// decodeXML reads XML as written by encodeXML. Without type attributes, elements with child elements are
+// objects, and other elements are strings. Repeated child elements are combined into an array.
+func decodeXML(body []byte) (interface{}, error) {
+
+	decoder := xml.NewDecoder(strings.NewReader(string(body)))
+
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			if err == io.EOF {
+				return nil, fmt.Errorf("no root element")
+			}
+			return nil, err
+		}
+		if start, isStart := token.(xml.StartElement); isStart {
+			root, err := readNode(decoder, start)
+			if err != nil {
+				return nil, err
+			}
+			return root.value()
+		}
+	}
+}
+
+// readNode reads the element that starts with the start element, including its children.
+func readNode(decoder *xml.Decoder, start xml.StartElement) (*xmlNode, error) {
+
+	node := &xmlNode{name: start.Name.Local, key: start.Name.Local}
+	for _, attribute := range start.Attr {
+		switch attribute.Name.Local {
+		case "type":
+			node.valueType = attribute.Value
+		case "key":
+			if start.Name.Local == xmlEntry {
+				node.key = attribute.Value
+			}
+		}
+	}
+
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch typed := token.(type) {
+		case xml.StartElement:
+			child, err := readNode(decoder, typed)
+			if err != nil {
+				return nil, err
+			}
+			node.children = append(node.children, child)
+		case xml.CharData:
+			node.text.Write(typed)
+		case xml.EndElement:
+			return node, nil
+		}
+	}
+}
+
+// value converts the node into the value it represents.
+func (node *xmlNode) value() (interface{}, error) {
+
+	valueType := node.valueType
+	if valueType == "" {
+		valueType = "string"
+		if len(node.children) > 0 {
+			valueType = "object"
+		}
+	}
+
+	text := node.text.String()
+
+	switch valueType {
+	case "object":
+		object := make(map[string]interface{}, len(node.children))
+		repeated := make(map[string]bool)
+		for _, child := range node.children {
+			value, err := child.value()
+			if err != nil {
+				return nil, err
+			}
+			existing, present := object[child.key]
+			switch {
+			case !present:
+				object[child.key] = value
+			case repeated[child.key]:
+				object[child.key] = append(existing.([]interface{}), value)
+			default:
+				object[child.key] = []interface{}{existing, value}
+				repeated[child.key] = true
+			}
+		}
+		return object, nil
+	case "array":
+		array := make([]interface{}, 0, len(node.children))
+		for _, child := range node.children {
+			value, err := child.value()
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, value)
+		}
+		return array, nil
+	case "string":
+		return text, nil
+	case "number":
+		number, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+		if err != nil {
+			return nil, fmt.Errorf("element `%s` is not a number", node.name)
+		}
+		return number, nil
+	case "boolean":
+		boolean, err := strconv.ParseBool(strings.TrimSpace(text))
+		if err != nil {
+			return nil, fmt.Errorf("element `%s` is not a boolean", node.name)
+		}
+		return boolean, nil
+	case "null":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("element `%s` has unknown type `%s`", node.name, node.valueType)
+	}
+}
@@ -45,6 +45,11 @@ type RequestLog struct {
 
 // New initializes a new logger
 func New() Logger {
+	return NewWithWriter(os.Stdout)
+}
+
+// NewWithWriter initializes a new logger that writes to w, use ioutil.Discard to silence it.
+func NewWithWriter(w io.Writer) Logger {
 
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
 
@@ -52,7 +57,7 @@ func New() Logger {
 
 	zerolog.SetGlobalLevel(logLevel)
 
-	logger := zerolog.New(os.Stdout).With().Timestamp().Logger()
+	logger := zerolog.New(w).With().Timestamp().Logger()
 
 	return Logger{logger: &logger}
 }
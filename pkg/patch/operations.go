@@ -0,0 +1,194 @@
+/*
+Copyright © 2020 Arnoud Kleinloog
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+var (
+	// ErrInvalidPatch indicates that the patch document itself is malformed.
+	ErrInvalidPatch = errors.New("invalid patch")
+	// ErrPathNotFound indicates that an operation references a location that does not exist.
+	ErrPathNotFound = errors.New("path not found")
+	// ErrTestFailed indicates that a test operation did not match the document.
+	ErrTestFailed = errors.New("test operation failed")
+)
+
+// Operation is a single JSON Patch operation as described in RFC 6902.
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// DecodeOperations parses a JSON Patch document into a list of operations.
+func DecodeOperations(body []byte) ([]Operation, error) {
+
+	var operations []Operation
+	err := json.Unmarshal(body, &operations)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPatch, err)
+	}
+
+	return operations, nil
+}
+
+// Apply applies the JSON Patch operations to the document in sequence, and returns the resulting document.
+// The document may be modified in place, it should be discarded when an error is returned.
+func Apply(document interface{}, operations []Operation) (interface{}, error) {
+
+	for _, operation := range operations {
+
+		var err error
+		document, err = operation.apply(document)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return document, nil
+}
+
+func (operation *Operation) apply(document interface{}) (interface{}, error) {
+
+	path, err := parsePointer(operation.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch operation.Op {
+	case "add":
+		value, err := operation.value()
+		if err != nil {
+			return nil, err
+		}
+		return add(document, path, value)
+
+	case "remove":
+		return remove(document, path)
+
+	case "replace":
+		value, err := operation.value()
+		if err != nil {
+			return nil, err
+		}
+		if len(path) == 0 {
+			return value, nil
+		}
+		document, err = remove(document, path)
+		if err != nil {
+			return nil, err
+		}
+		return add(document, path, value)
+
+	case "move":
+		from, err := operation.from()
+		if err != nil {
+			return nil, err
+		}
+		if operation.From == operation.Path {
+			return document, nil
+		}
+		if strings.HasPrefix(operation.Path, operation.From+"/") {
+			return nil, fmt.Errorf("%w: cannot move `%s` into one of its children", ErrInvalidPatch, operation.From)
+		}
+		value, err := get(document, from)
+		if err != nil {
+			return nil, err
+		}
+		document, err = remove(document, from)
+		if err != nil {
+			return nil, err
+		}
+		return add(document, path, value)
+
+	case "copy":
+		from, err := operation.from()
+		if err != nil {
+			return nil, err
+		}
+		value, err := get(document, from)
+		if err != nil {
+			return nil, err
+		}
+		return add(document, path, deepCopy(value))
+
+	case "test":
+		expected, err := operation.value()
+		if err != nil {
+			return nil, err
+		}
+		actual, err := get(document, path)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrTestFailed, err)
+		}
+		if !reflect.DeepEqual(expected, actual) {
+			return nil, fmt.Errorf("%w: value at `%s` does not match", ErrTestFailed, operation.Path)
+		}
+		return document, nil
+
+	default:
+		return nil, fmt.Errorf("%w: unknown operation `%s`", ErrInvalidPatch, operation.Op)
+	}
+}
+
+// value decodes the value of the operation, which is mandatory for add, replace and test.
+func (operation *Operation) value() (interface{}, error) {
+
+	if operation.Value == nil {
+		return nil, fmt.Errorf("%w: %s operation requires a value", ErrInvalidPatch, operation.Op)
+	}
+
+	var value interface{}
+	err := json.Unmarshal(operation.Value, &value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPatch, err)
+	}
+
+	return value, nil
+}
+
+// from parses the from location of the operation, which is used by move and copy.
+func (operation *Operation) from() ([]string, error) {
+	return parsePointer(operation.From)
+}
+
+// deepCopy duplicates a decoded JSON value, so that copies do not share maps or slices.
+func deepCopy(value interface{}) interface{} {
+
+	switch node := value.(type) {
+	case map[string]interface{}:
+		duplicate := make(map[string]interface{}, len(node))
+		for name, child := range node {
+			duplicate[name] = deepCopy(child)
+		}
+		return duplicate
+	case []interface{}:
+		duplicate := make([]interface{}, len(node))
+		for index, child := range node {
+			duplicate[index] = deepCopy(child)
+		}
+		return duplicate
+	default:
+		return value
+	}
+}
@@ -0,0 +1,100 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func decode(t *testing.T, document string) interface{} {
+	var value interface{}
+	err := json.Unmarshal([]byte(document), &value)
+	assert.NoError(t, err, "Error occurred while decoding test document")
+	return value
+}
+
+func TestMergePatch(t *testing.T) {
+
+	target := decode(t, `{"a":"b","c":{"d":"e","f":"g"}}`)
+	mergePatch := decode(t, `{"a":"z","c":{"f":null}}`)
+
+	result := MergePatch(target, mergePatch)
+
+	assert.Equal(t, decode(t, `{"a":"z","c":{"d":"e"}}`), result)
+}
+
+func TestMergePatchWithNonObjectReplacesTarget(t *testing.T) {
+
+	result := MergePatch(decode(t, `{"a":"b"}`), decode(t, `["c"]`))
+
+	assert.Equal(t, decode(t, `["c"]`), result)
+}
+
+func TestApplyOperations(t *testing.T) {
+
+	document := decode(t, `{"id":"1","name":"Something","tags":["a","c"],"nested":{"x":1}}`)
+
+	operations, err := DecodeOperations([]byte(`[
+		{"op":"test","path":"/name","value":"Something"},
+		{"op":"replace","path":"/name","value":"Something Else"},
+		{"op":"add","path":"/tags/1","value":"b"},
+		{"op":"add","path":"/tags/-","value":"d"},
+		{"op":"remove","path":"/tags/0"},
+		{"op":"copy","from":"/nested","path":"/copied"},
+		{"op":"move","from":"/nested/x","path":"/y"}
+	]`))
+	if !assert.NoError(t, err, "Error occurred while decoding operations") {
+		return
+	}
+
+	result, err := Apply(document, operations)
+
+	if assert.NoError(t, err, "Error occurred while applying operations") {
+		expected := `{"id":"1","name":"Something Else","tags":["b","c","d"],"nested":{},"copied":{"x":1},"y":1}`
+		assert.Equal(t, decode(t, expected), result)
+	}
+}
+
+func TestFailingTestOperation(t *testing.T) {
+
+	operations, _ := DecodeOperations([]byte(`[{"op":"test","path":"/name","value":"Other"}]`))
+
+	_, err := Apply(decode(t, `{"name":"Something"}`), operations)
+
+	assert.True(t, errors.Is(err, ErrTestFailed))
+}
+
+func TestOperationOnMissingPath(t *testing.T) {
+
+	operations, _ := DecodeOperations([]byte(`[{"op":"replace","path":"/a/b","value":1}]`))
+
+	_, err := Apply(decode(t, `{"name":"Something"}`), operations)
+
+	assert.True(t, errors.Is(err, ErrPathNotFound))
+}
+
+func TestInvalidOperations(t *testing.T) {
+
+	for _, document := range []string{
+		`[{"op":"unknown","path":"/a"}]`,
+		`[{"op":"add","path":"/a"}]`,
+		`[{"op":"add","path":"a","value":1}]`,
+		`[{"op":"move","from":"/a","path":"/a/b"}]`,
+	} {
+		operations, err := DecodeOperations([]byte(document))
+		if assert.NoError(t, err, "Error occurred while decoding operations") {
+			_, err = Apply(decode(t, `{"a":{}}`), operations)
+			assert.True(t, errors.Is(err, ErrInvalidPatch), document)
+		}
+	}
+}
+
+func TestPointerEscaping(t *testing.T) {
+
+	tokens, err := parsePointer("/a~1b/c~0d")
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"a/b", "c~d"}, tokens)
+	}
+}
@@ -0,0 +1,186 @@
+/*
+Copyright © 2020 Arnoud Kleinloog
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package patch
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parsePointer splits a JSON Pointer as described in RFC 6901 into its unescaped reference tokens.
+func parsePointer(pointer string) ([]string, error) {
+
+	if pointer == "" {
+		return []string{}, nil
+	}
+
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("%w: pointer `%s` does not start with /", ErrInvalidPatch, pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for index, token := range tokens {
+		token = strings.Replace(token, "~1", "/", -1)
+		tokens[index] = strings.Replace(token, "~0", "~", -1)
+	}
+
+	return tokens, nil
+}
+
+// arrayIndex converts a reference token into an index in an array of the given length.
+// When allowEnd is set, the index may point just past the last element, which is used for adding items.
+func arrayIndex(token string, length int, allowEnd bool) (int, error) {
+
+	if allowEnd && token == "-" {
+		return length, nil
+	}
+
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("%w: invalid array index `%s`", ErrPathNotFound, token)
+	}
+
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 {
+		return 0, fmt.Errorf("%w: invalid array index `%s`", ErrPathNotFound, token)
+	}
+
+	if index > length || (index == length && !allowEnd) {
+		return 0, fmt.Errorf("%w: array index %d out of bounds", ErrPathNotFound, index)
+	}
+
+	return index, nil
+}
+
+// get returns the value located by the tokens.
+func get(document interface{}, tokens []string) (interface{}, error) {
+
+	current := document
+
+	for _, token := range tokens {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			value, exists := node[token]
+			if !exists {
+				return nil, fmt.Errorf("%w: member `%s` does not exist", ErrPathNotFound, token)
+			}
+			current = value
+		case []interface{}:
+			index, err := arrayIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			current = node[index]
+		default:
+			return nil, fmt.Errorf("%w: cannot reference `%s` in a scalar value", ErrPathNotFound, token)
+		}
+	}
+
+	return current, nil
+}
+
+// add inserts the value at the location of the tokens, and returns the resulting document.
+func add(document interface{}, tokens []string, value interface{}) (interface{}, error) {
+
+	if len(tokens) == 0 {
+		return value, nil
+	}
+
+	token := tokens[0]
+	last := len(tokens) == 1
+
+	switch node := document.(type) {
+	case map[string]interface{}:
+		if last {
+			node[token] = value
+			return node, nil
+		}
+		child, exists := node[token]
+		if !exists {
+			return nil, fmt.Errorf("%w: member `%s` does not exist", ErrPathNotFound, token)
+		}
+		child, err := add(child, tokens[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		node[token] = child
+		return node, nil
+	case []interface{}:
+		index, err := arrayIndex(token, len(node), last)
+		if err != nil {
+			return nil, err
+		}
+		if last {
+			node = append(node, nil)
+			copy(node[index+1:], node[index:])
+			node[index] = value
+			return node, nil
+		}
+		child, err := add(node[index], tokens[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		node[index] = child
+		return node, nil
+	default:
+		return nil, fmt.Errorf("%w: cannot reference `%s` in a scalar value", ErrPathNotFound, token)
+	}
+}
+
+// remove deletes the value at the location of the tokens, and returns the resulting document.
+func remove(document interface{}, tokens []string) (interface{}, error) {
+
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("%w: cannot remove the whole document", ErrInvalidPatch)
+	}
+
+	token := tokens[0]
+	last := len(tokens) == 1
+
+	switch node := document.(type) {
+	case map[string]interface{}:
+		child, exists := node[token]
+		if !exists {
+			return nil, fmt.Errorf("%w: member `%s` does not exist", ErrPathNotFound, token)
+		}
+		if last {
+			delete(node, token)
+			return node, nil
+		}
+		child, err := remove(child, tokens[1:])
+		if err != nil {
+			return nil, err
+		}
+		node[token] = child
+		return node, nil
+	case []interface{}:
+		index, err := arrayIndex(token, len(node), false)
+		if err != nil {
+			return nil, err
+		}
+		if last {
+			return append(node[:index], node[index+1:]...), nil
+		}
+		child, err := remove(node[index], tokens[1:])
+		if err != nil {
+			return nil, err
+		}
+		node[index] = child
+		return node, nil
+	default:
+		return nil, fmt.Errorf("%w: cannot reference `%s` in a scalar value", ErrPathNotFound, token)
+	}
+}
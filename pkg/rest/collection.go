@@ -0,0 +1,374 @@
+package rest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/akleinloog/lazy-rest/pkg/storage"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// collectionItem is a single item of a collection, together with the key it is stored under.
+type collectionItem struct {
+	key     string
+	content interface{}
+}
+
+// sortField is a field to sort collection items on, as specified in the sort query parameter.
+type sortField struct {
+	path       string
+	descending bool
+}
+
+// page describes which part of a sorted collection is requested.
+type page struct {
+	limit     int
+	offset    int
+	cursor    *pageCursor
+	useCursor bool
+}
+
+// pageCursor is the position after which the next page starts when using cursor pagination.
+// It holds the sort values and key of the last item of the previous page, so pages remain stable when items are added or removed,
+// together with the sort order the values belong to.
+type pageCursor struct {
+	Key    string        `json:"k"`
+	Values []interface{} `json:"v"`
+	Sort   string        `json:"s,omitempty"`
+}
+
+// toCollectionItems converts the documents in a collection into a list of items, ordered by key.
+func toCollectionItems(documents []*storage.Document, idField string) []collectionItem {
+
+	items := make([]collectionItem, 0, len(documents))
+	for _, document := range documents {
+		content := document.Content
+		if !document.IsJSON() {
+			content = dataDescription(document, idField)
+		}
+		items = append(items, collectionItem{key: path.Base(document.Key), content: content})
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].key < items[j].key
+	})
+
+	return items
+}
+
+// parseSortFields parses the sort query parameter, a comma separated list of (dotted) fields that are
+// prefixed with a minus sign to sort in descending order.
+func parseSortFields(query url.Values) []sortField {
+
+	var fields []sortField
+
+	for _, parameter := range query["sort"] {
+		for _, field := range strings.Split(parameter, ",") {
+			field = strings.TrimSpace(field)
+			descending := strings.HasPrefix(field, "-")
+			field = strings.TrimPrefix(strings.TrimPrefix(field, "-"), "+")
+			if field != "" {
+				fields = append(fields, sortField{path: field, descending: descending})
+			}
+		}
+	}
+
+	return fields
+}
+
+// sortItems sorts collection items on the fields, using the key to order items with equal values.
+func sortItems(items []collectionItem, fields []sortField) {
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return compareItems(sortValues(items[i], fields), items[i].key, sortValues(items[j], fields), items[j].key, fields) < 0
+	})
+}
+
+// sortValues returns the values of an item for the fields it is sorted on.
+func sortValues(item collectionItem, fields []sortField) []interface{} {
+
+	values := make([]interface{}, len(fields))
+	for index, field := range fields {
+		values[index], _ = lookupField(item.content, field.path)
+	}
+	return values
+}
+
+// compareItems compares two items by their sort values, and by their keys when all values are equal.
+func compareItems(values []interface{}, key string, otherValues []interface{}, otherKey string, fields []sortField) int {
+
+	for index, field := range fields {
+		result := compareValues(values[index], otherValues[index])
+		if field.descending {
+			result = -result
+		}
+		if result != 0 {
+			return result
+		}
+	}
+
+	return strings.Compare(key, otherKey)
+}
+
+// compareValues compares two decoded JSON values. Values of different types are ordered
+// as missing or null, booleans, numbers, strings and finally objects and arrays.
+func compareValues(value interface{}, other interface{}) int {
+
+	rank, otherRank := typeRank(value), typeRank(other)
+	if rank != otherRank {
+		return rank - otherRank
+	}
+
+	switch typed := value.(type) {
+	case bool:
+		otherBool := other.(bool)
+		switch {
+		case typed == otherBool:
+			return 0
+		case otherBool:
+			return -1
+		default:
+			return 1
+		}
+	case float64:
+		otherNumber := other.(float64)
+		switch {
+		case typed < otherNumber:
+			return -1
+		case typed > otherNumber:
+			return 1
+		default:
+			return 0
+		}
+	case string:
+		return strings.Compare(typed, other.(string))
+	case nil:
+		return 0
+	default:
+		encoded, _ := json.Marshal(value)
+		otherEncoded, _ := json.Marshal(other)
+		return strings.Compare(string(encoded), string(otherEncoded))
+	}
+}
+
+func typeRank(value interface{}) int {
+
+	switch value.(type) {
+	case nil:
+		return 0
+	case bool:
+		return 1
+	case float64:
+		return 2
+	case string:
+		return 3
+	default:
+		return 4
+	}
+}
+
+// lookupField returns the value of a (dotted) field in a decoded JSON document, and indicates if it exists.
+func lookupField(content interface{}, path string) (interface{}, bool) {
+
+	current := content
+
+	for _, name := range strings.Split(path, ".") {
+		object, isObject := current.(map[string]interface{})
+		if !isObject {
+			return nil, false
+		}
+		value, exists := object[name]
+		if !exists {
+			return nil, false
+		}
+		current = value
+	}
+
+	return current, true
+}
+
+// parsePage parses the limit, offset and cursor query parameters.
+func parsePage(query url.Values) (*page, error) {
+
+	requested := &page{}
+
+	if limit := query.Get("limit"); limit != "" {
+		value, err := strconv.Atoi(limit)
+		if err != nil || value < 0 {
+			return nil, fmt.Errorf("Invalid limit `%s`, expected a positive number", limit)
+		}
+		requested.limit = value
+	}
+
+	if offset := query.Get("offset"); offset != "" {
+		value, err := strconv.Atoi(offset)
+		if err != nil || value < 0 {
+			return nil, fmt.Errorf("Invalid offset `%s`, expected a positive number", offset)
+		}
+		requested.offset = value
+	}
+
+	if _, present := query["cursor"]; present {
+		if requested.offset != 0 {
+			return nil, fmt.Errorf("Cursor and offset cannot be combined")
+		}
+		requested.useCursor = true
+		if cursor := query.Get("cursor"); cursor != "" {
+			decoded, err := decodeCursor(cursor)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid cursor `%s`", cursor)
+			}
+			requested.cursor = decoded
+		}
+	}
+
+	return requested, nil
+}
+
+func decodeCursor(cursor string) (*pageCursor, error) {
+
+	bytes, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	decoded := &pageCursor{}
+	err = json.Unmarshal(bytes, decoded)
+	if err != nil {
+		return nil, err
+	}
+
+	return decoded, nil
+}
+
+func encodeCursor(item collectionItem, fields []sortField) string {
+
+	bytes, _ := json.Marshal(&pageCursor{Key: item.key, Values: sortValues(item, fields), Sort: sortOrder(fields)})
+	return base64.RawURLEncoding.EncodeToString(bytes)
+}
+
+// checkCursor checks that the requested cursor was returned for the same sort order, as its values cannot be
+// compared to the items otherwise.
+func checkCursor(requested *page, fields []sortField) error {
+
+	cursor := requested.cursor
+	if cursor == nil {
+		return nil
+	}
+
+	if len(cursor.Values) != len(fields) || cursor.Sort != sortOrder(fields) {
+		return errors.New("Invalid cursor, it was returned for another sort order")
+	}
+
+	return nil
+}
+
+// sortOrder formats the sort fields as they are specified in the sort query parameter, like name,-nested.field.
+func sortOrder(fields []sortField) string {
+
+	order := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if field.descending {
+			order = append(order, "-"+field.path)
+		} else {
+			order = append(order, field.path)
+		}
+	}
+
+	return strings.Join(order, ",")
+}
+
+// paginate selects the requested page from the sorted items, and adds the Link and X-Total-Count headers to the response.
+func paginate(writer http.ResponseWriter, request *http.Request, items []collectionItem, fields []sortField, requested *page) []collectionItem {
+
+	total := len(items)
+	writer.Header().Set("X-Total-Count", strconv.Itoa(total))
+
+	if requested.useCursor {
+		return paginateWithCursor(writer, request, items, fields, requested)
+	}
+
+	if requested.limit == 0 && requested.offset == 0 {
+		return items
+	}
+
+	start := requested.offset
+	if start > total {
+		start = total
+	}
+
+	end := total
+	if requested.limit > 0 && start+requested.limit < total {
+		end = start + requested.limit
+	}
+
+	if requested.limit > 0 {
+		links := []string{link(request, "first", map[string]string{"offset": "0"})}
+
+		if start > 0 {
+			previous := start - requested.limit
+			if previous < 0 {
+				previous = 0
+			}
+			links = append(links, link(request, "prev", map[string]string{"offset": strconv.Itoa(previous)}))
+		}
+
+		if end < total {
+			links = append(links, link(request, "next", map[string]string{"offset": strconv.Itoa(end)}))
+		}
+
+		last := 0
+		if total > 0 {
+			last = (total - 1) / requested.limit * requested.limit
+		}
+		links = append(links, link(request, "last", map[string]string{"offset": strconv.Itoa(last)}))
+
+		writer.Header().Set("Link", strings.Join(links, ", "))
+	}
+
+	return items[start:end]
+}
+
+// paginateWithCursor selects the page of items following the cursor.
+func paginateWithCursor(writer http.ResponseWriter, request *http.Request, items []collectionItem, fields []sortField, requested *page) []collectionItem {
+
+	start := 0
+	if requested.cursor != nil {
+		start = sort.Search(len(items), func(index int) bool {
+			item := items[index]
+			return compareItems(sortValues(item, fields), item.key, requested.cursor.Values, requested.cursor.Key, fields) > 0
+		})
+	}
+
+	end := len(items)
+	if requested.limit > 0 && start+requested.limit < end {
+		end = start + requested.limit
+	}
+
+	links := []string{link(request, "first", map[string]string{"cursor": ""})}
+	if end < len(items) && end > start {
+		links = append(links, link(request, "next", map[string]string{"cursor": encodeCursor(items[end-1], fields)}))
+	}
+	writer.Header().Set("Link", strings.Join(links, ", "))
+
+	return items[start:end]
+}
+
+// link formats a link to the current request with some of its query parameters replaced, as described in RFC 8288.
+func link(request *http.Request, relation string, parameters map[string]string) string {
+
+	query := request.URL.Query()
+	for name, value := range parameters {
+		query.Set(name, value)
+	}
+
+	target := url.URL{Path: request.URL.Path, RawQuery: query.Encode()}
+
+	return fmt.Sprintf(`<%s>; rel="%s"`, target.String(), relation)
+}
@@ -0,0 +1,124 @@
+package rest
+
+import (
+	"github.com/akleinloog/lazy-rest/pkg/storage"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// testDocuments converts test content into the documents of a collection.
+func testDocuments(contents map[string]interface{}) []*storage.Document {
+	documents := make([]*storage.Document, 0, len(contents))
+	for key, content := range contents {
+		documents = append(documents, &storage.Document{Key: "items/" + key, Content: content})
+	}
+	return documents
+}
+
+func testCollection() []collectionItem {
+	return toCollectionItems(testDocuments(map[string]interface{}{
+		"a": map[string]interface{}{"id": "a", "rank": 3.0, "nested": map[string]interface{}{"name": "x"}},
+		"b": map[string]interface{}{"id": "b", "rank": 1.0, "nested": map[string]interface{}{"name": "z"}},
+		"c": map[string]interface{}{"id": "c", "rank": 2.0, "nested": map[string]interface{}{"name": "y"}},
+		"d": map[string]interface{}{"id": "d", "rank": 2.0},
+	}), "id")
+}
+
+func keys(items []collectionItem) []string {
+	result := make([]string, 0, len(items))
+	for _, item := range items {
+		result = append(result, item.key)
+	}
+	return result
+}
+
+func TestItemsAreOrderedByKeyByDefault(t *testing.T) {
+
+	items := testCollection()
+	sortItems(items, parseSortFields(url.Values{}))
+
+	assert.Equal(t, []string{"a", "b", "c", "d"}, keys(items))
+}
+
+func TestItemsCanBeSortedOnMultipleFields(t *testing.T) {
+
+	items := testCollection()
+	sortItems(items, parseSortFields(url.Values{"sort": {"-rank,nested.name"}}))
+
+	assert.Equal(t, []string{"a", "d", "c", "b"}, keys(items))
+}
+
+func TestOffsetPagination(t *testing.T) {
+
+	request := httptest.NewRequest("GET", "/items?limit=2&offset=1", nil)
+	recorder := httptest.NewRecorder()
+
+	requested, err := parsePage(request.URL.Query())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	items := paginate(recorder, request, testCollection(), nil, requested)
+
+	assert.Equal(t, []string{"b", "c"}, keys(items))
+	assert.Equal(t, "4", recorder.Header().Get("X-Total-Count"))
+	assert.Contains(t, recorder.Header().Get("Link"), `</items?limit=2&offset=3>; rel="next"`)
+	assert.Contains(t, recorder.Header().Get("Link"), `</items?limit=2&offset=0>; rel="prev"`)
+	assert.Contains(t, recorder.Header().Get("Link"), `</items?limit=2&offset=2>; rel="last"`)
+}
+
+func TestCursorPagination(t *testing.T) {
+
+	fields := parseSortFields(url.Values{"sort": {"rank"}})
+	items := testCollection()
+	sortItems(items, fields)
+
+	requested := &page{limit: 2, useCursor: true}
+	first := paginate(httptest.NewRecorder(), httptest.NewRequest("GET", "/items", nil), items, fields, requested)
+	assert.Equal(t, []string{"b", "c"}, keys(first))
+
+	cursor, err := decodeCursor(encodeCursor(first[len(first)-1], fields))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	requested.cursor = cursor
+	second := paginate(httptest.NewRecorder(), httptest.NewRequest("GET", "/items", nil), items, fields, requested)
+	assert.Equal(t, []string{"d", "a"}, keys(second))
+}
+
+func TestInvalidPageParameters(t *testing.T) {
+
+	_, err := parsePage(url.Values{"limit": {"-1"}})
+	assert.Error(t, err)
+
+	_, err = parsePage(url.Values{"cursor": {"not a cursor"}})
+	assert.Error(t, err)
+}
+
+func TestCursorOfAnotherSortOrder(t *testing.T) {
+
+	items := testCollection()
+	unsorted := encodeCursor(items[0], nil)
+	ranked := encodeCursor(items[0], parseSortFields(url.Values{"sort": {"rank"}}))
+
+	for _, cursor := range []string{unsorted, ranked} {
+		requested, err := parsePage(url.Values{"cursor": {cursor}})
+		if assert.NoError(t, err) {
+			assert.Error(t, checkCursor(requested, parseSortFields(url.Values{"sort": {"-rank"}})), "Cursors should not be reused with another sort")
+		}
+	}
+
+	requested, _ := parsePage(url.Values{"cursor": {ranked}})
+	assert.NoError(t, checkCursor(requested, parseSortFields(url.Values{"sort": {"rank"}})))
+
+	server := newTestServer(t)
+	send(t, "PUT", server.URL+"/items/", `[{"id":"1","p":1},{"id":"2","p":2}]`)
+
+	response, body := send(t, "GET", server.URL+"/items?limit=1&sort=-p&cursor="+unsorted, "")
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+	assert.Contains(t, body, "Invalid cursor")
+}
@@ -0,0 +1,85 @@
+package rest
+
+import (
+	"github.com/akleinloog/lazy-rest/pkg/storage"
+	"net/http"
+	"strings"
+)
+
+// entityTag formats a storage version as a strong entity tag.
+func entityTag(version string) string {
+	return `"` + version + `"`
+}
+
+// currentVersion returns the version of a document, or an empty version when there is no document.
+func currentVersion(document *storage.Document) string {
+	if document == nil {
+		return ""
+	}
+	return document.Version
+}
+
+// setEntityTag adds the ETag header for a storage version to the response.
+func setEntityTag(writer http.ResponseWriter, version string) {
+	writer.Header().Set("ETag", entityTag(version))
+}
+
+// checkPreconditions evaluates the If-Match and If-None-Match headers of a request against the current version
+// of a resource, and returns the status code to respond with when a precondition fails, or 0 when they hold.
+func checkPreconditions(request *http.Request, version string, exists bool) int {
+
+	if ifMatch := request.Header.Get("If-Match"); ifMatch != "" {
+		if !exists || !matchesEntityTag(ifMatch, version, false) {
+			return http.StatusPreconditionFailed
+		}
+	}
+
+	if ifNoneMatch := request.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		if exists && matchesEntityTag(ifNoneMatch, version, true) {
+			if request.Method == http.MethodGet || request.Method == http.MethodHead {
+				return http.StatusNotModified
+			}
+			return http.StatusPreconditionFailed
+		}
+	}
+
+	return 0
+}
+
+// matchesEntityTag indicates if a list of entity tags from a conditional header matches the version.
+// Weak comparison is used for If-None-Match, strong comparison for If-Match.
+func matchesEntityTag(header string, version string, weak bool) bool {
+
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+
+	current := entityTag(version)
+
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if strings.HasPrefix(tag, "W/") {
+			if !weak {
+				continue
+			}
+			tag = tag[2:]
+		}
+		if tag == current {
+			return true
+		}
+	}
+
+	return false
+}
+
+// respondToFailedPrecondition writes the response for a failed precondition.
+func respondToFailedPrecondition(writer http.ResponseWriter, status int, version string) {
+
+	if status == http.StatusNotModified {
+		setEntityTag(writer, version)
+		writer.WriteHeader(status)
+		return
+	}
+
+	http.Error(writer, http.StatusText(status), status)
+}
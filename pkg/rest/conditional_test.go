@@ -0,0 +1,113 @@
+package rest
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+func TestConditionalGet(t *testing.T) {
+
+	server := newTestServer(t)
+
+	send(t, "PUT", server.URL+"/items/1", `{"name":"First"}`)
+
+	response, _ := send(t, "GET", server.URL+"/items/1", "")
+	etag := response.Header.Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	response, body := send(t, "GET", server.URL+"/items/1", "", "If-None-Match", etag)
+	assert.Equal(t, http.StatusNotModified, response.StatusCode)
+	assert.Equal(t, etag, response.Header.Get("ETag"))
+	assert.Empty(t, body, "Not modified responses should not have a body")
+
+	response, _ = send(t, "GET", server.URL+"/items/1", "", "If-None-Match", `"other", W/`+etag)
+	assert.Equal(t, http.StatusNotModified, response.StatusCode, "If-None-Match should use weak comparison")
+
+	response, _ = send(t, "GET", server.URL+"/items/1", "", "If-None-Match", `"other"`)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+
+	response, _ = send(t, "GET", server.URL+"/items/1", "", "If-Match", `"other"`)
+	assert.Equal(t, http.StatusPreconditionFailed, response.StatusCode)
+
+	response, _ = send(t, "GET", server.URL+"/items/1", "", "If-Match", etag)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+}
+
+func TestConditionalPut(t *testing.T) {
+
+	server := newTestServer(t)
+
+	response, _ := send(t, "PUT", server.URL+"/items/1", `{"name":"First"}`, "If-None-Match", "*")
+	assert.Equal(t, http.StatusAccepted, response.StatusCode, "If-None-Match: * should allow creating an item")
+	etag := response.Header.Get("ETag")
+
+	response, _ = send(t, "PUT", server.URL+"/items/1", `{"name":"Overwritten"}`, "If-None-Match", "*")
+	assert.Equal(t, http.StatusPreconditionFailed, response.StatusCode, "If-None-Match: * should not overwrite an item")
+
+	response, _ = send(t, "PUT", server.URL+"/items/1", `{"name":"Second"}`, "If-Match", "W/"+etag)
+	assert.Equal(t, http.StatusPreconditionFailed, response.StatusCode, "If-Match should use strong comparison")
+
+	response, _ = send(t, "PUT", server.URL+"/items/1", `{"name":"Second"}`, "If-Match", `"stale", `+etag)
+	assert.Equal(t, http.StatusAccepted, response.StatusCode)
+
+	response, _ = send(t, "PUT", server.URL+"/items/1", `{"name":"Third"}`, "If-Match", etag)
+	assert.Equal(t, http.StatusPreconditionFailed, response.StatusCode, "The entity tag should change with the item")
+
+	response, _ = send(t, "PUT", server.URL+"/items/2", `{"name":"Missing"}`, "If-Match", "*")
+	assert.Equal(t, http.StatusPreconditionFailed, response.StatusCode, "If-Match: * should require an existing item")
+
+	_, body := send(t, "GET", server.URL+"/items/1", "")
+	assert.JSONEq(t, `{"id":"1","name":"Second"}`, body)
+}
+
+func TestConditionalPatch(t *testing.T) {
+
+	server := newTestServer(t)
+
+	response, _ := send(t, "PUT", server.URL+"/items/1", `{"name":"First"}`)
+	etag := response.Header.Get("ETag")
+
+	response, _ = send(t, "PATCH", server.URL+"/items/1", `{"name":"Second"}`,
+		"Content-Type", mergePatchContentType, "If-Match", `"other"`)
+	assert.Equal(t, http.StatusPreconditionFailed, response.StatusCode)
+
+	response, _ = send(t, "PATCH", server.URL+"/items/1", `{"name":"Second"}`,
+		"Content-Type", mergePatchContentType, "If-None-Match", etag)
+	assert.Equal(t, http.StatusPreconditionFailed, response.StatusCode, "Changes should fail instead of not modified")
+
+	response, _ = send(t, "PATCH", server.URL+"/items/1", `{"name":"Second"}`,
+		"Content-Type", mergePatchContentType, "If-Match", etag)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.NotEqual(t, etag, response.Header.Get("ETag"))
+}
+
+func TestConditionalDelete(t *testing.T) {
+
+	server := newTestServer(t)
+
+	response, _ := send(t, "PUT", server.URL+"/items/1", `{"name":"First"}`)
+	etag := response.Header.Get("ETag")
+
+	response, _ = send(t, "DELETE", server.URL+"/items/1", "", "If-Match", `"other"`)
+	assert.Equal(t, http.StatusPreconditionFailed, response.StatusCode)
+
+	response, _ = send(t, "GET", server.URL+"/items/1", "")
+	assert.Equal(t, http.StatusOK, response.StatusCode, "Nothing should be deleted when a precondition fails")
+
+	response, _ = send(t, "DELETE", server.URL+"/items/1", "", "If-Match", etag)
+	assert.Equal(t, http.StatusAccepted, response.StatusCode)
+
+	response, _ = send(t, "GET", server.URL+"/items/1", "")
+	assert.Equal(t, http.StatusNotFound, response.StatusCode)
+}
+
+func TestMatchesEntityTag(t *testing.T) {
+
+	assert.True(t, matchesEntityTag(`"abc"`, "abc", false))
+	assert.True(t, matchesEntityTag(` "x" , "abc" `, "abc", false))
+	assert.True(t, matchesEntityTag(`*`, "abc", false))
+	assert.False(t, matchesEntityTag(`W/"abc"`, "abc", false), "Weak tags should not match in strong comparison")
+	assert.True(t, matchesEntityTag(`W/"abc"`, "abc", true))
+	assert.False(t, matchesEntityTag(`"abd"`, "abc", true))
+}
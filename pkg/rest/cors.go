@@ -0,0 +1,141 @@
+package rest
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORS configures Cross-Origin Resource Sharing, which allows browser front-ends on other origins to use the server.
+type CORS struct {
+	// AllowedOrigins are the origins that may use the server, like http://localhost:3000.
+	// Use * to allow any origin, or a * in place of a sub domain like https://*.example.com.
+	AllowedOrigins []string
+	// EchoOrigin responds with the origin of the request instead of *, which is required for credentials.
+	EchoOrigin bool
+	// AllowedMethods are the methods that may be used, by default all methods the server supports.
+	AllowedMethods []string
+	// AllowedHeaders are the request headers that may be used, by default the headers that are requested.
+	AllowedHeaders []string
+	// ExposedHeaders are the response headers that are made available to the front-end.
+	ExposedHeaders []string
+	// AllowCredentials allows requests with cookies or authorization headers.
+	AllowCredentials bool
+	// MaxAge is how long the result of a preflight request may be cached.
+	MaxAge time.Duration
+}
+
+var (
+	defaultCORSMethods        = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+	defaultCORSExposedHeaders = []string{"ETag", "Link", "Location", "X-Total-Count", "X-Created-At", "X-Created-By", "X-Version", "Preference-Applied", "Idempotent-Replayed"}
+)
+
+// WithCORS enables Cross-Origin Resource Sharing, methods and exposed headers default to what the server supports.
+func WithCORS(cors CORS) Option {
+	return func(server *Server) {
+		if len(cors.AllowedMethods) == 0 {
+			cors.AllowedMethods = defaultCORSMethods
+		}
+		if len(cors.ExposedHeaders) == 0 {
+			cors.ExposedHeaders = defaultCORSExposedHeaders
+		}
+		server.cors = &cors
+	}
+}
+
+// corsHandler is a middleware that adds the CORS headers to responses, and answers preflight requests.
+func (server *Server) corsHandler(next http.Handler) http.Handler {
+
+	if server.cors == nil {
+		return next
+	}
+
+	cors := server.cors
+
+	fn := func(writer http.ResponseWriter, request *http.Request) {
+
+		origin := request.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(writer, request)
+			return
+		}
+
+		header := writer.Header()
+		header.Add("Vary", "Origin")
+
+		isPreflight := request.Method == http.MethodOptions && request.Header.Get("Access-Control-Request-Method") != ""
+
+		if !cors.allowsOrigin(origin) {
+			if isPreflight {
+				writer.WriteHeader(http.StatusNoContent)
+				return
+			}
+			next.ServeHTTP(writer, request)
+			return
+		}
+
+		if cors.allowsAnyOrigin() && !cors.EchoOrigin && !cors.AllowCredentials {
+			header.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			header.Set("Access-Control-Allow-Origin", origin)
+		}
+
+		if cors.AllowCredentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if isPreflight {
+			header.Add("Vary", "Access-Control-Request-Method")
+			header.Add("Vary", "Access-Control-Request-Headers")
+			header.Set("Access-Control-Allow-Methods", strings.Join(cors.AllowedMethods, ", "))
+			if len(cors.AllowedHeaders) > 0 {
+				header.Set("Access-Control-Allow-Headers", strings.Join(cors.AllowedHeaders, ", "))
+			} else if requested := request.Header.Get("Access-Control-Request-Headers"); requested != "" {
+				header.Set("Access-Control-Allow-Headers", requested)
+			}
+			if cors.MaxAge > 0 {
+				header.Set("Access-Control-Max-Age", strconv.Itoa(int(cors.MaxAge.Seconds())))
+			}
+			writer.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if len(cors.ExposedHeaders) > 0 {
+			header.Set("Access-Control-Expose-Headers", strings.Join(cors.ExposedHeaders, ", "))
+		}
+
+		next.ServeHTTP(writer, request)
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+func (cors *CORS) allowsAnyOrigin() bool {
+	for _, allowed := range cors.AllowedOrigins {
+		if allowed == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsOrigin indicates if the origin matches one of the allowed origins.
+func (cors *CORS) allowsOrigin(origin string) bool {
+
+	for _, allowed := range cors.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+		if wildcard := strings.Index(allowed, "*"); wildcard >= 0 {
+			prefix, suffix := allowed[:wildcard], allowed[wildcard+1:]
+			if len(origin) >= len(prefix)+len(suffix) &&
+				strings.HasPrefix(strings.ToLower(origin), strings.ToLower(prefix)) &&
+				strings.HasSuffix(strings.ToLower(origin), strings.ToLower(suffix)) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
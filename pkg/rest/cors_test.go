@@ -0,0 +1,49 @@
+package rest
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCORSPreflight(t *testing.T) {
+
+	server := newTestServer(t, WithCORS(CORS{AllowedOrigins: []string{"http://localhost:3000"}, MaxAge: time.Minute}))
+
+	response, _ := send(t, "OPTIONS", server.URL+"/items/1", "",
+		"Origin", "http://localhost:3000",
+		"Access-Control-Request-Method", "PUT",
+		"Access-Control-Request-Headers", "Content-Type, If-Match")
+
+	assert.Equal(t, http.StatusNoContent, response.StatusCode)
+	assert.Equal(t, "http://localhost:3000", response.Header.Get("Access-Control-Allow-Origin"))
+	assert.Contains(t, response.Header.Get("Access-Control-Allow-Methods"), "PUT")
+	assert.Equal(t, "Content-Type, If-Match", response.Header.Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "60", response.Header.Get("Access-Control-Max-Age"))
+}
+
+func TestCORSExposesHeaders(t *testing.T) {
+
+	server := newTestServer(t, WithCORS(CORS{AllowedOrigins: []string{"*"}}))
+
+	send(t, "PUT", server.URL+"/items/1", `{"name":"Something"}`)
+	response, _ := send(t, "GET", server.URL+"/items/1", "", "Origin", "http://localhost:3000")
+
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "*", response.Header.Get("Access-Control-Allow-Origin"))
+	assert.Contains(t, response.Header.Get("Access-Control-Expose-Headers"), "ETag")
+	assert.Contains(t, response.Header.Get("Access-Control-Expose-Headers"), "X-Total-Count")
+}
+
+func TestCORSWithCredentialsEchoesOrigin(t *testing.T) {
+
+	server := newTestServer(t, WithCORS(CORS{AllowedOrigins: []string{"https://*.example.com"}, AllowCredentials: true}))
+
+	response, _ := send(t, "GET", server.URL+"/items", "", "Origin", "https://app.example.com")
+	assert.Equal(t, "https://app.example.com", response.Header.Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", response.Header.Get("Access-Control-Allow-Credentials"))
+
+	response, _ = send(t, "GET", server.URL+"/items", "", "Origin", "https://example.org")
+	assert.Empty(t, response.Header.Get("Access-Control-Allow-Origin"))
+}
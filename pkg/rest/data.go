@@ -0,0 +1,282 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/akleinloog/lazy-rest/pkg/storage"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strings"
+)
+
+const (
+	multipartContentType = "multipart/form-data"
+	formContentType      = "application/x-www-form-urlencoded"
+	defaultDataType      = "application/octet-stream"
+	defaultPartType      = "text/plain; charset=utf-8"
+)
+
+// isJSONContent indicates if a body with the media type holds JSON. Requests without a content type are JSON,
+// as are form encoded requests with a JSON body, which is what curl sends by default.
+func isJSONContent(mediaType string, body []byte) bool {
+
+	switch {
+	case mediaType == "", mediaType == "application/json", strings.HasSuffix(mediaType, "+json"):
+		return true
+	case mediaType == formContentType:
+		return json.Valid(body)
+	default:
+		return false
+	}
+}
+
+// dataMetadata returns the metadata of data that is sent with the headers, which is stored along with it.
+func dataMetadata(header http.Header) storage.Metadata {
+
+	metadata := storage.Metadata{
+		ContentType:     header.Get("Content-Type"),
+		ContentEncoding: header.Get("Content-Encoding"),
+	}
+
+	if metadata.ContentType == "" {
+		metadata.ContentType = defaultDataType
+	}
+
+	if disposition := header.Get("Content-Disposition"); disposition != "" {
+		if _, params, err := mime.ParseMediaType(disposition); err == nil {
+			metadata.Filename = params["filename"]
+		}
+	}
+
+	return metadata
+}
+
+// putData stores a body that is not JSON at the key, exactly as it was received.
+func (server *Server) putData(writer http.ResponseWriter, request *http.Request, key string, body []byte) {
+
+	current, exists, err := server.store.Get(request.Context(), key)
+	if err != nil {
+		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if status := checkPreconditions(request, currentVersion(current), exists); status != 0 {
+		respondToFailedPrecondition(writer, status, currentVersion(current))
+		return
+	}
+
+	if server.rejectsData(writer, key) {
+		return
+	}
+
+	document, err := server.store.PutData(request.Context(), key, body, dataMetadata(request.Header))
+	if err != nil {
+		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	setEntityTag(writer, document.Version)
+	writer.WriteHeader(http.StatusAccepted)
+	server.respond(writer, "")
+}
+
+// serveData responds with the data of a document that is not JSON, with the content type it was stored with.
+// Range requests are supported, and ?download makes browsers save the data rather than display it.
+func (server *Server) serveData(writer http.ResponseWriter, request *http.Request, document *storage.Document) {
+
+	header := writer.Header()
+	header.Set("Content-Type", document.Metadata.ContentType)
+	if document.Metadata.ContentEncoding != "" {
+		header.Set("Content-Encoding", document.Metadata.ContentEncoding)
+	}
+
+	disposition := "inline"
+	if _, download := request.URL.Query()["download"]; download {
+		disposition = "attachment"
+	}
+	filename := document.Metadata.Filename
+	if filename == "" {
+		filename = path.Base(document.Key)
+	}
+	header.Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": filename}))
+
+	setEntityTag(writer, document.Version)
+	http.ServeContent(writer, request, "", document.Modified, bytes.NewReader(document.Data))
+}
+
+// dataDescription describes a document that is not JSON, for use in collections.
+func dataDescription(document *storage.Document, idField string) map[string]interface{} {
+
+	description := map[string]interface{}{
+		idField:       path.Base(document.Key),
+		"contentType": document.Metadata.ContentType,
+		"size":        len(document.Data),
+	}
+
+	if document.Metadata.Filename != "" {
+		description["filename"] = document.Metadata.Filename
+	}
+
+	return description
+}
+
+// part is a part of a multipart request, which is stored as a separate document.
+type part struct {
+	name     string
+	isJSON   bool
+	content  interface{}
+	data     []byte
+	metadata storage.Metadata
+}
+
+// readParts reads the parts of a multipart body. Parts are named after their form field, or their file name
+// when they have no field name. Parts with a JSON content type are decoded, others are kept as they are.
+func readParts(body []byte, boundary string) ([]part, error) {
+
+	var parts []part
+	names := make(map[string]bool)
+
+	reader := multipart.NewReader(bytes.NewReader(body), boundary)
+	for {
+		current, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Invalid multipart body: %v", err)
+		}
+
+		name := current.FormName()
+		if name == "" {
+			name = current.FileName()
+		}
+		if err := checkId(name); err != nil {
+			return nil, fmt.Errorf("Part %d has invalid name `%s`, %s", len(parts), name, err.Error())
+		}
+		if names[name] {
+			return nil, fmt.Errorf("Part %d has duplicate name `%s`", len(parts), name)
+		}
+		names[name] = true
+
+		data, err := ioutil.ReadAll(current)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid multipart body: %v", err)
+		}
+
+		metadata := dataMetadata(http.Header(current.Header))
+		if current.Header.Get("Content-Type") == "" {
+			metadata.ContentType = defaultPartType
+		}
+		if metadata.Filename == "" {
+			metadata.Filename = current.FileName()
+		}
+
+		stored := part{name: name, data: data, metadata: metadata}
+
+		mediaType, _, _ := mime.ParseMediaType(metadata.ContentType)
+		if mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") {
+			err = json.Unmarshal(data, &stored.content)
+			if err != nil {
+				return nil, fmt.Errorf("Part %d (`%s`) holds invalid JSON", len(parts), name)
+			}
+			stored.isJSON = true
+		}
+
+		parts = append(parts, stored)
+	}
+
+	return parts, nil
+}
+
+// storeParts stores every part of a multipart body as a separate document in the collection at the key, and responds
+// with the locations of the created and updated documents. Posted parts do not replace existing documents, like other
+// posted items.
+func (server *Server) storeParts(writer http.ResponseWriter, request *http.Request, key string, body []byte, boundary string, status int) {
+
+	preferences := preferencesOf(request)
+	preference := preferences["return"]
+	if preference != returnMinimal {
+		_, err := responseFormat(request)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusNotAcceptable)
+			return
+		}
+	}
+
+	parts, err := readParts(body, boundary)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Parts that are PUT replace the documents that already exist
+	upsert := status != http.StatusCreated || server.upserts(writer, preferences)
+
+	var violations []schemaViolation
+	existed := make([]bool, len(parts))
+
+	for index, current := range parts {
+		partKey := path.Join(key, current.name)
+		stored, exists, err := server.store.Get(request.Context(), partKey)
+		if err != nil {
+			http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		if exists && !upsert {
+			http.Error(writer, fmt.Sprintf("Item with id `%s` already exists", current.name), http.StatusConflict)
+			return
+		}
+		existed[index] = exists
+		if !current.isJSON {
+			violations = append(violations, server.schemas.checkData(partKey, "/"+current.name)...)
+		} else {
+			err = server.prepareDocument(current.content, partKey)
+			if err != nil {
+				http.Error(writer, err.Error(), http.StatusBadRequest)
+				return
+			}
+			err = server.manageFields(request, current.content, stored)
+			if err != nil {
+				http.Error(writer, err.Error(), http.StatusBadRequest)
+				return
+			}
+			violations = append(violations, server.schemas.check(partKey, current.content, "/"+current.name)...)
+		}
+	}
+
+	if len(violations) > 0 {
+		server.respondWithViolations(writer, violations)
+		return
+	}
+
+	summary := postSummary{Created: []string{}, Updated: []string{}}
+
+	for index, current := range parts {
+		partKey := path.Join(key, current.name)
+		if current.isJSON {
+			_, err = server.store.Put(request.Context(), partKey, current.content)
+		} else {
+			_, err = server.store.PutData(request.Context(), partKey, current.data, current.metadata)
+		}
+		if err != nil {
+			http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		if existed[index] {
+			summary.Updated = append(summary.Updated, locationOf(partKey))
+		} else {
+			summary.Created = append(summary.Created, locationOf(partKey))
+		}
+	}
+
+	if status == http.StatusCreated && len(summary.Created) == 0 {
+		status = http.StatusOK
+	}
+
+	server.respondWithPreference(writer, request, status, preference, summary)
+}
@@ -0,0 +1,105 @@
+package rest
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"mime/multipart"
+	"net/http"
+	"testing"
+)
+
+func TestPutAndGetData(t *testing.T) {
+
+	server := newTestServer(t)
+	data := "\x89PNG\r\n\x1a\n\x00\x01\x02\x03\xff"
+
+	response, _ := send(t, "PUT", server.URL+"/images/logo", data, "Content-Type", "image/png")
+	assert.Equal(t, http.StatusAccepted, response.StatusCode)
+	etag := response.Header.Get("ETag")
+
+	response, body := send(t, "GET", server.URL+"/images/logo", "")
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, data, body, "Data should be returned exactly as it was stored")
+	assert.Equal(t, "image/png", response.Header.Get("Content-Type"))
+	assert.Equal(t, etag, response.Header.Get("ETag"))
+	assert.Equal(t, `inline; filename=logo`, response.Header.Get("Content-Disposition"))
+
+	response, body = send(t, "GET", server.URL+"/images/logo", "", "Range", "bytes=1-3")
+	assert.Equal(t, http.StatusPartialContent, response.StatusCode)
+	assert.Equal(t, "PNG", body)
+
+	response, _ = send(t, "GET", server.URL+"/images/logo", "", "If-None-Match", etag)
+	assert.Equal(t, http.StatusNotModified, response.StatusCode)
+
+	response, _ = send(t, "GET", server.URL+"/images/logo?download", "")
+	assert.Equal(t, `attachment; filename=logo`, response.Header.Get("Content-Disposition"))
+
+	response, body = send(t, "GET", server.URL+"/images", "")
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.JSONEq(t, `[{"id":"logo","contentType":"image/png","size":13}]`, body)
+
+	response, _ = send(t, "PATCH", server.URL+"/images/logo", `{"name":"Logo"}`, "Content-Type", mergePatchContentType)
+	assert.Equal(t, http.StatusConflict, response.StatusCode)
+}
+
+func TestPutTextWithEncoding(t *testing.T) {
+
+	server := newTestServer(t)
+
+	response, _ := send(t, "PUT", server.URL+"/notes/1", "not json", "Content-Type", "text/plain", "Content-Encoding", "identity")
+	assert.Equal(t, http.StatusAccepted, response.StatusCode)
+
+	response, body := send(t, "GET", server.URL+"/notes/1", "")
+	assert.Equal(t, "not json", body)
+	assert.Equal(t, "text/plain", response.Header.Get("Content-Type"))
+	assert.Equal(t, "identity", response.Header.Get("Content-Encoding"))
+}
+
+func TestPostMultipart(t *testing.T) {
+
+	server := newTestServer(t)
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("title", "Holiday")
+	file, _ := form.CreateFormFile("photo", "beach.jpg")
+	file.Write([]byte{0xff, 0xd8, 0xff})
+	form.Close()
+
+	response, summary := send(t, "POST", server.URL+"/uploads", body.String(), "Content-Type", form.FormDataContentType())
+	assert.Equal(t, http.StatusCreated, response.StatusCode)
+	assert.Equal(t, "application/json", response.Header.Get("Content-Type"))
+	assert.JSONEq(t, `{"created":["/uploads/title","/uploads/photo"],"updated":[]}`, summary)
+
+	response, text := send(t, "GET", server.URL+"/uploads/title", "")
+	assert.Equal(t, "Holiday", text)
+	assert.Equal(t, "text/plain; charset=utf-8", response.Header.Get("Content-Type"))
+
+	response, text = send(t, "GET", server.URL+"/uploads/photo", "")
+	assert.Equal(t, "\xff\xd8\xff", text)
+	assert.Equal(t, "application/octet-stream", response.Header.Get("Content-Type"))
+	assert.Equal(t, `inline; filename=beach.jpg`, response.Header.Get("Content-Disposition"))
+
+	response, _ = send(t, "POST", server.URL+"/uploads", body.String(), "Content-Type", form.FormDataContentType())
+	assert.Equal(t, http.StatusConflict, response.StatusCode, "Posted parts should not overwrite existing items")
+
+	response, summary = send(t, "POST", server.URL+"/uploads", body.String(), "Content-Type", form.FormDataContentType(),
+		"Prefer", "resolution=merge-duplicates")
+	assert.Equal(t, http.StatusOK, response.StatusCode, "Replacing parts should not be reported as created")
+	assert.Equal(t, "resolution=merge-duplicates", response.Header.Get("Preference-Applied"))
+	assert.JSONEq(t, `{"created":[],"updated":["/uploads/title","/uploads/photo"]}`, summary)
+}
+
+func TestPostData(t *testing.T) {
+
+	server := newTestServer(t)
+
+	response, _ := send(t, "POST", server.URL+"/notes", "Remember this", "Content-Type", "text/plain")
+	assert.Equal(t, http.StatusCreated, response.StatusCode)
+
+	location := response.Header.Get("Location")
+	if assert.NotEmpty(t, location, "Location of stored data should be returned") {
+		_, body := send(t, "GET", server.URL+location, "")
+		assert.Equal(t, "Remember this", body)
+	}
+}
@@ -1,24 +1,111 @@
 package rest
 
 import (
+	"fmt"
 	"github.com/akleinloog/lazy-rest/pkg/storage"
 	"net/http"
+	"path"
+	"strings"
 )
 
-func handleDELETE(writer http.ResponseWriter, request *http.Request) {
+func (server *Server) handleDELETE(writer http.ResponseWriter, request *http.Request) {
 
 	key := getURLWithSlashRemovedIfNeeded(request)
 
-	wasPresent, err := storage.Remove(key)
+	current, exists, err := server.store.Get(request.Context(), key)
+	if err != nil {
+		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if status := checkPreconditions(request, currentVersion(current), exists); status != 0 {
+		respondToFailedPrecondition(writer, status, currentVersion(current))
+		return
+	}
+
+	if !exists {
+		server.deleteCollection(writer, request, key)
+		return
+	}
+
+	wasPresent, err := server.store.Delete(request.Context(), key)
 
 	if err != nil {
 		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 	} else {
 		if wasPresent {
 			writer.WriteHeader(http.StatusAccepted)
-			respond(writer, "")
+			server.respond(writer, "")
 		} else {
 			http.Error(writer, http.StatusText(http.StatusNotFound), http.StatusNotFound)
 		}
 	}
 }
+
+// deleteCollection deletes the items in the collection at the key that match the filters in the query, and with depth
+// or recursive the items in the collections below it as well. It responds with the number of deleted items.
+// Recursive deletes of top-level collections need to be confirmed with their path in the confirm query parameter.
+func (server *Server) deleteCollection(writer http.ResponseWriter, request *http.Request, key string) {
+
+	query := request.URL.Query()
+
+	depth, nested, err := parseDepth(query)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !nested {
+		depth = 0
+	}
+
+	filters, err := parseFilters(query)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if depth > 0 && !strings.Contains(key, "/") && query.Get("confirm") != "/"+key {
+		http.Error(writer, fmt.Sprintf("Deleting everything below `/%s` needs to be confirmed with ?confirm=/%s", key, key), http.StatusPreconditionRequired)
+		return
+	}
+
+	var documents []string
+	found := false
+	err = server.walkCollections(request.Context(), key, depth, func(collection string, collectionDocuments []*storage.Document) {
+		found = found || len(collectionDocuments) > 0
+		for _, item := range filterItems(toCollectionItems(collectionDocuments, server.idField), filters) {
+			documents = append(documents, path.Join(collection, item.key))
+		}
+	})
+	if err != nil {
+		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if !found {
+		// Collections that only hold other collections exist as well
+		found, err = server.hasCollections(request.Context(), key)
+		if err != nil {
+			http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		if !found {
+			http.Error(writer, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+	}
+
+	deleted := 0
+	for _, document := range documents {
+		wasPresent, err := server.store.Delete(request.Context(), document)
+		if err != nil {
+			http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		if wasPresent {
+			deleted++
+		}
+	}
+
+	server.respondWithContent(writer, request, map[string]interface{}{"deleted": deleted})
+}
@@ -0,0 +1,76 @@
+package rest
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+func TestDeleteItem(t *testing.T) {
+
+	server := newNestedTestServer(t)
+
+	response, _ := send(t, "DELETE", server.URL+"/api/items/1", "")
+	assert.Equal(t, http.StatusAccepted, response.StatusCode)
+
+	response, body := send(t, "GET", server.URL+"/api/items", "")
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.JSONEq(t, `[{"id":"2","kind":"b"}]`, body)
+
+	response, _ = send(t, "GET", server.URL+"/api/items/1/comments/c", "")
+	assert.Equal(t, http.StatusOK, response.StatusCode, "Deleting an item should keep the collections below it")
+}
+
+func TestDeleteCollection(t *testing.T) {
+
+	server := newNestedTestServer(t)
+
+	response, body := send(t, "DELETE", server.URL+"/api/items/", "")
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.JSONEq(t, `{"deleted":2}`, body)
+
+	response, _ = send(t, "GET", server.URL+"/api/items/1/comments/c", "")
+	assert.Equal(t, http.StatusOK, response.StatusCode, "Collections below the collection should be kept")
+
+	response, _ = send(t, "DELETE", server.URL+"/missing", "")
+	assert.Equal(t, http.StatusNotFound, response.StatusCode)
+}
+
+func TestDeleteMatchingItems(t *testing.T) {
+
+	server := newNestedTestServer(t)
+
+	response, body := send(t, "DELETE", server.URL+"/api/items?kind=a", "")
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.JSONEq(t, `{"deleted":1}`, body)
+
+	response, body = send(t, "GET", server.URL+"/api/items", "")
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.JSONEq(t, `[{"id":"2","kind":"b"}]`, body, "Only the matching items should be deleted")
+
+	response, body = send(t, "DELETE", server.URL+"/api/items?kind=z", "")
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.JSONEq(t, `{"deleted":0}`, body)
+}
+
+func TestDeleteCollectionRecursively(t *testing.T) {
+
+	server := newNestedTestServer(t)
+
+	response, body := send(t, "DELETE", server.URL+"/api/items?recursive=true&kind=a", "")
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.JSONEq(t, `{"deleted":2}`, body, "Filters should apply to the items in every collection")
+
+	response, _ = send(t, "DELETE", server.URL+"/api?recursive=true", "")
+	assert.Equal(t, http.StatusPreconditionRequired, response.StatusCode, "Recursive deletes of top-level collections should be confirmed")
+
+	response, _ = send(t, "DELETE", server.URL+"/api?recursive=true&confirm=/other", "")
+	assert.Equal(t, http.StatusPreconditionRequired, response.StatusCode, "The confirmation should match the path")
+
+	response, body = send(t, "DELETE", server.URL+"/api?recursive=true&confirm=/api", "")
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.JSONEq(t, `{"deleted":3}`, body)
+
+	response, _ = send(t, "GET", server.URL+"/api", "")
+	assert.Equal(t, http.StatusNotFound, response.StatusCode, "Nothing should remain below the collection")
+}
@@ -0,0 +1,248 @@
+package rest
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// reservedParameters are query parameters that control the response, rather than filter the items in it.
+var reservedParameters = map[string]bool{
+	"sort":      true,
+	"limit":     true,
+	"offset":    true,
+	"cursor":    true,
+	"download":  true,
+	"format":    true,
+	"depth":     true,
+	"recursive": true,
+	"flat":      true,
+	"confirm":   true,
+	"_history":  true,
+	"_version":  true,
+}
+
+// filterOperators are the supported operators, used as field[operator]=value in the query string.
+var filterOperators = map[string]bool{
+	"eq":       true,
+	"ne":       true,
+	"gt":       true,
+	"gte":      true,
+	"lt":       true,
+	"lte":      true,
+	"in":       true,
+	"nin":      true,
+	"like":     true,
+	"regex":    true,
+	"contains": true,
+	"exists":   true,
+}
+
+var filterParameterPattern = regexp.MustCompile(`^([^\[\]]+)(?:\[([^\[\]]*)\])?$`)
+
+// filterCondition is a single condition on a (dotted) field of the items in a collection.
+type filterCondition struct {
+	path     string
+	operator string
+	value    string
+	pattern  *regexp.Regexp
+	exists   bool
+}
+
+// parseFilters parses the query parameters that are not reserved into filter conditions.
+// Conditions are of the form field=value or field[operator]=value, and all of them must hold for an item to match.
+func parseFilters(query url.Values) ([]filterCondition, error) {
+
+	parameters := make([]string, 0, len(query))
+	for parameter := range query {
+		if !reservedParameters[parameter] {
+			parameters = append(parameters, parameter)
+		}
+	}
+	sort.Strings(parameters)
+
+	var conditions []filterCondition
+
+	for _, parameter := range parameters {
+
+		match := filterParameterPattern.FindStringSubmatch(parameter)
+		if match == nil {
+			return nil, fmt.Errorf("Invalid filter `%s`, expected field=value or field[operator]=value", parameter)
+		}
+
+		operator := match[2]
+		if operator == "" {
+			operator = "eq"
+		}
+		if !filterOperators[operator] {
+			return nil, fmt.Errorf("Unknown filter operator `%s` in `%s`, supported operators are %s", operator, parameter, supportedOperators())
+		}
+
+		for _, value := range query[parameter] {
+
+			condition := filterCondition{path: match[1], operator: operator, value: value}
+
+			switch operator {
+			case "regex":
+				pattern, err := regexp.Compile(value)
+				if err != nil {
+					return nil, fmt.Errorf("Invalid regular expression `%s` in `%s`: %s", value, parameter, err)
+				}
+				condition.pattern = pattern
+			case "exists":
+				exists := true
+				if value != "" {
+					parsed, err := strconv.ParseBool(value)
+					if err != nil {
+						return nil, fmt.Errorf("Invalid value `%s` in `%s`, expected true or false", value, parameter)
+					}
+					exists = parsed
+				}
+				condition.exists = exists
+			}
+
+			conditions = append(conditions, condition)
+		}
+	}
+
+	return conditions, nil
+}
+
+func supportedOperators() string {
+
+	operators := make([]string, 0, len(filterOperators))
+	for operator := range filterOperators {
+		operators = append(operators, operator)
+	}
+	sort.Strings(operators)
+
+	return strings.Join(operators, ", ")
+}
+
+// filterItems returns the items that match all filter conditions.
+func filterItems(items []collectionItem, conditions []filterCondition) []collectionItem {
+
+	if len(conditions) == 0 {
+		return items
+	}
+
+	filtered := make([]collectionItem, 0, len(items))
+
+	for _, item := range items {
+		matches := true
+		for index := range conditions {
+			if !conditions[index].matches(item.content) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			filtered = append(filtered, item)
+		}
+	}
+
+	return filtered
+}
+
+// matches indicates if the content of an item satisfies the condition.
+func (condition *filterCondition) matches(content interface{}) bool {
+
+	value, exists := lookupField(content, condition.path)
+
+	switch condition.operator {
+	case "exists":
+		return exists == condition.exists
+	case "ne":
+		return !exists || !equalsQueryValue(value, condition.value)
+	case "nin":
+		return !exists || !equalsAnyQueryValue(value, strings.Split(condition.value, ","))
+	}
+
+	if !exists {
+		return false
+	}
+
+	switch condition.operator {
+	case "eq":
+		return equalsQueryValue(value, condition.value)
+	case "in":
+		return equalsAnyQueryValue(value, strings.Split(condition.value, ","))
+	case "gt", "gte", "lt", "lte":
+		other, ok := coerceQueryValue(condition.value, value)
+		if !ok {
+			return false
+		}
+		result := compareValues(value, other)
+		switch condition.operator {
+		case "gt":
+			return result > 0
+		case "gte":
+			return result >= 0
+		case "lt":
+			return result < 0
+		default:
+			return result <= 0
+		}
+	case "like":
+		text, isString := value.(string)
+		return isString && strings.Contains(strings.ToLower(text), strings.ToLower(condition.value))
+	case "regex":
+		text, isString := value.(string)
+		return isString && condition.pattern.MatchString(text)
+	case "contains":
+		switch typed := value.(type) {
+		case []interface{}:
+			for _, element := range typed {
+				if equalsQueryValue(element, condition.value) {
+					return true
+				}
+			}
+			return false
+		case string:
+			return strings.Contains(typed, condition.value)
+		default:
+			return false
+		}
+	}
+
+	return false
+}
+
+func equalsAnyQueryValue(value interface{}, queryValues []string) bool {
+
+	for _, queryValue := range queryValues {
+		if equalsQueryValue(value, queryValue) {
+			return true
+		}
+	}
+	return false
+}
+
+// equalsQueryValue indicates if a decoded JSON value equals a value from the query string.
+func equalsQueryValue(value interface{}, queryValue string) bool {
+
+	other, ok := coerceQueryValue(queryValue, value)
+	return ok && compareValues(value, other) == 0 && typeRank(value) < 4
+}
+
+// coerceQueryValue converts a value from the query string to the type of a decoded JSON value, so they can be compared.
+func coerceQueryValue(queryValue string, like interface{}) (interface{}, bool) {
+
+	switch like.(type) {
+	case float64:
+		number, err := strconv.ParseFloat(queryValue, 64)
+		return number, err == nil
+	case bool:
+		boolean, err := strconv.ParseBool(queryValue)
+		return boolean, err == nil
+	case nil:
+		return nil, queryValue == "null"
+	case string:
+		return queryValue, true
+	default:
+		return nil, false
+	}
+}
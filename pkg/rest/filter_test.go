@@ -0,0 +1,63 @@
+package rest
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/url"
+	"testing"
+)
+
+func filterTestCollection() []collectionItem {
+	return toCollectionItems(testDocuments(map[string]interface{}{
+		"1": map[string]interface{}{"status": "open", "price": 5.0, "tags": []interface{}{"red", "blue"}, "owner": map[string]interface{}{"name": "Alice"}},
+		"2": map[string]interface{}{"status": "open", "price": 15.0, "tags": []interface{}{"red"}, "archived": true},
+		"3": map[string]interface{}{"status": "closed", "price": 25.0, "tags": []interface{}{"green"}, "owner": map[string]interface{}{"name": "Bob"}},
+	}), "id")
+}
+
+func filtered(t *testing.T, query string) []string {
+
+	values, err := url.ParseQuery(query)
+	if !assert.NoError(t, err) {
+		return nil
+	}
+
+	conditions, err := parseFilters(values)
+	if !assert.NoError(t, err, query) {
+		return nil
+	}
+
+	return keys(filterItems(filterTestCollection(), conditions))
+}
+
+func TestFilterOperators(t *testing.T) {
+
+	assert.Equal(t, []string{"1", "2"}, filtered(t, "status=open"))
+	assert.Equal(t, []string{"3"}, filtered(t, "status[ne]=open"))
+	assert.Equal(t, []string{"2"}, filtered(t, "status=open&price[gte]=10&tags[contains]=red"))
+	assert.Equal(t, []string{"1", "2"}, filtered(t, "price[lt]=25"))
+	assert.Equal(t, []string{"1", "3"}, filtered(t, "price[in]=5,25"))
+	assert.Equal(t, []string{"1"}, filtered(t, "owner.name[like]=ali"))
+	assert.Equal(t, []string{"3"}, filtered(t, "owner.name[regex]=^B"))
+	assert.Equal(t, []string{"2"}, filtered(t, "archived=true"))
+	assert.Equal(t, []string{"1", "3"}, filtered(t, "owner[exists]"))
+	assert.Equal(t, []string{"2"}, filtered(t, "owner[exists]=false"))
+	assert.Equal(t, []string{"1", "2", "3"}, filtered(t, "sort=-price&limit=1"))
+}
+
+func TestUnknownFilterOperatorIsRejected(t *testing.T) {
+
+	_, err := parseFilters(url.Values{"price[between]": {"1,2"}})
+
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "Unknown filter operator `between`")
+	}
+}
+
+func TestInvalidFiltersAreRejected(t *testing.T) {
+
+	for _, parameter := range []string{"price[gt", "name[regex]", "owner[exists]"} {
+		value := "("
+		_, err := parseFilters(url.Values{parameter: {value}})
+		assert.Error(t, err, parameter)
+	}
+}
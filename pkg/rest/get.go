@@ -1,15 +1,40 @@
 package rest
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"github.com/akleinloog/lazy-rest/pkg/storage"
 	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"time"
 )
 
-func handleGET(writer http.ResponseWriter, request *http.Request) {
+func (server *Server) handleGET(writer http.ResponseWriter, request *http.Request) {
+
+	if request.URL.Path == collectionsPath {
+		server.handleCollections(writer, request)
+		return
+	}
+
+	if isSchemasPath(request.URL.Path) {
+		server.handleSchemas(writer, request)
+		return
+	}
 
 	key := getURLWithSlashRemovedIfNeeded(request)
 
-	content, exists, err := storage.Retrieve(key)
+	if _, requested := request.URL.Query()["_history"]; requested {
+		server.respondWithHistory(writer, request, key)
+		return
+	}
+
+	if number := request.URL.Query().Get("_version"); number != "" {
+		server.respondWithRevision(writer, request, key, number)
+		return
+	}
+
+	document, exists, err := server.store.Get(request.Context(), key)
 	if err != nil {
 		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
@@ -17,24 +42,148 @@ func handleGET(writer http.ResponseWriter, request *http.Request) {
 
 	if exists {
 		// Request matches a single item, we can return it
-		respondWithContent(writer, content)
+		if !document.IsJSON() {
+			server.serveData(writer, request, document)
+			return
+		}
+		if status := checkPreconditions(request, document.Version, exists); status != 0 {
+			respondToFailedPrecondition(writer, status, document.Version)
+			return
+		}
+		server.setManagedHeaders(writer, document.Content)
+		setLastModified(writer, document.Modified)
+		setEntityTag(writer, document.Version)
+		server.respondWithContent(writer, request, server.present(document.Content))
 		return
 	}
 
-	var itemsInCollection, getErr = storage.RetrieveCollection(key)
+	var itemsInCollection, getErr = server.store.List(request.Context(), key)
 
 	if getErr != nil {
 		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
 
-	if len(itemsInCollection) > 0 {
-		contentItems := make([]interface{}, 0, len(itemsInCollection))
-		for _, item := range itemsInCollection {
-			contentItems = append(contentItems, item)
+	if len(itemsInCollection) == 0 {
+		// Collections that only hold other collections exist as well
+		found, err := server.hasCollections(request.Context(), key)
+		if err != nil {
+			http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		if !found {
+			http.Error(writer, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
 		}
-		respondWithContent(writer, contentItems)
-	} else {
-		http.Error(writer, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+	}
+
+	query := request.URL.Query()
+
+	depth, nested, err := parseDepth(query)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	requestedPage, err := parsePage(query)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filters, err := parseFilters(query)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sortFields := parseSortFields(query)
+
+	err = checkCursor(requestedPage, sortFields)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	setLastModified(writer, lastModified(itemsInCollection))
+
+	if nested {
+		if requestedPage.limit != 0 || requestedPage.offset != 0 || requestedPage.useCursor {
+			http.Error(writer, "Pagination is not supported for nested listings", http.StatusBadRequest)
+			return
+		}
+		server.respondWithNested(writer, request, key, depth, filters, sortFields)
+		return
+	}
+
+	items := filterItems(toCollectionItems(itemsInCollection, server.idField), filters)
+	sortItems(items, sortFields)
+	items = paginate(writer, request, items, sortFields, requestedPage)
+
+	contentItems := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		contentItems = append(contentItems, server.present(item.content))
+	}
+	server.respondWithCollection(writer, request, contentItems)
+}
+
+// handleHEAD responds like GET without the body, but with the Content-Length of the body that GET responds with.
+func (server *Server) handleHEAD(writer http.ResponseWriter, request *http.Request) {
+
+	recorder := httptest.NewRecorder()
+	server.handleGET(recorder, request)
+
+	for name, values := range recorder.Header() {
+		writer.Header()[name] = values
+	}
+	if writer.Header().Get("Content-Length") == "" {
+		writer.Header().Set("Content-Length", strconv.Itoa(recorder.Body.Len()))
+	}
+	writer.WriteHeader(recorder.Code)
+}
+
+// respondWithCollection responds with the content of a collection, with an entity tag that is derived from the response,
+// so clients can check if the collection has changed with If-None-Match.
+func (server *Server) respondWithCollection(writer http.ResponseWriter, request *http.Request, content interface{}) {
+
+	recorder := httptest.NewRecorder()
+	server.respondWithContent(recorder, request, content)
+
+	for name, values := range recorder.Header() {
+		writer.Header()[name] = values
+	}
+
+	if recorder.Code == http.StatusOK {
+		hash := sha256.Sum256(recorder.Body.Bytes())
+		version := hex.EncodeToString(hash[:16])
+		if status := checkPreconditions(request, version, true); status != 0 {
+			respondToFailedPrecondition(writer, status, version)
+			return
+		}
+		setEntityTag(writer, version)
+	}
+
+	writer.WriteHeader(recorder.Code)
+	server.respond(writer, recorder.Body.String())
+}
+
+// lastModified returns when the most recently stored of the documents was stored, or zero when that is not known.
+func lastModified(documents []*storage.Document) time.Time {
+
+	var latest time.Time
+	for _, document := range documents {
+		if document.Modified.After(latest) {
+			latest = document.Modified
+		}
+	}
+
+	return latest
+}
+
+// setLastModified adds the Last-Modified header for when a document was stored, unless it is not known
+// or already set from the managed fields.
+func setLastModified(writer http.ResponseWriter, modified time.Time) {
+	if !modified.IsZero() && writer.Header().Get("Last-Modified") == "" {
+		writer.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
 	}
 }
@@ -0,0 +1,159 @@
+package rest
+
+import (
+	"fmt"
+	"github.com/akleinloog/lazy-rest/pkg/storage"
+	"net/http"
+	"strconv"
+)
+
+// WithHistory makes the server keep the history of its documents, limited by the retention.
+func WithHistory(retention storage.Retention) Option {
+	return func(server *Server) {
+		server.history = &retention
+	}
+}
+
+// withChange adds the request to its context, so it is recorded in the history of the documents it changes.
+func withChange(request *http.Request) *http.Request {
+	return request.WithContext(storage.WithChange(request.Context(), storage.Change{
+		Method:    request.Method,
+		Path:      request.URL.RequestURI(),
+		RemoteIP:  ipFromHostPort(request.RemoteAddr),
+		UserAgent: request.UserAgent(),
+	}))
+}
+
+// storeHistory returns the history of the store, or responds with 404 Not Found when no history is kept.
+func (server *Server) storeHistory(writer http.ResponseWriter) (storage.History, bool) {
+
+	history, keepsHistory := server.store.(storage.History)
+	if !keepsHistory {
+		http.Error(writer, "History is not kept, it needs to be enabled with a retention", http.StatusNotFound)
+	}
+
+	return history, keepsHistory
+}
+
+// parseRevisionNumber parses the number of a revision, which is a positive integer.
+func parseRevisionNumber(value string) (int, error) {
+
+	number, err := strconv.Atoi(value)
+	if err != nil || number < 1 {
+		return 0, fmt.Errorf("Invalid version `%s`, versions are numbered from 1", value)
+	}
+
+	return number, nil
+}
+
+// respondWithHistory responds with the revisions of the document at the key, oldest first.
+func (server *Server) respondWithHistory(writer http.ResponseWriter, request *http.Request, key string) {
+
+	history, keepsHistory := server.storeHistory(writer)
+	if !keepsHistory {
+		return
+	}
+
+	revisions, err := history.History(request.Context(), key)
+	if err != nil {
+		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if len(revisions) == 0 {
+		http.Error(writer, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	var content interface{}
+	err = storage.Convert(revisions, &content)
+	if err != nil {
+		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	server.respondWithContent(writer, request, content)
+}
+
+// respondWithRevision responds with the document at the key as it was stored in a revision.
+func (server *Server) respondWithRevision(writer http.ResponseWriter, request *http.Request, key string, value string) {
+
+	number, err := parseRevisionNumber(value)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	history, keepsHistory := server.storeHistory(writer)
+	if !keepsHistory {
+		return
+	}
+
+	_, document, exists, err := history.Revision(request.Context(), key, number)
+	if err != nil {
+		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if !exists {
+		http.Error(writer, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	if document == nil {
+		http.Error(writer, fmt.Sprintf("Version %d deleted the document", number), http.StatusGone)
+		return
+	}
+
+	if !document.IsJSON() {
+		server.serveData(writer, request, document)
+		return
+	}
+
+	server.setManagedHeaders(writer, document.Content)
+	setEntityTag(writer, document.Version)
+	server.respondWithContent(writer, request, server.present(document.Content))
+}
+
+// restoreRevision stores the document at the key as it was stored in a revision.
+func (server *Server) restoreRevision(writer http.ResponseWriter, request *http.Request, key string, value string) {
+
+	number, err := parseRevisionNumber(value)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	history, keepsHistory := server.storeHistory(writer)
+	if !keepsHistory {
+		return
+	}
+
+	current, exists, err := server.store.Get(request.Context(), key)
+	if err != nil {
+		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if status := checkPreconditions(request, currentVersion(current), exists); status != 0 {
+		respondToFailedPrecondition(writer, status, currentVersion(current))
+		return
+	}
+
+	document, exists, err := history.Restore(request.Context(), key, number)
+	if err != nil {
+		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if !exists {
+		http.Error(writer, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	if document != nil {
+		setEntityTag(writer, document.Version)
+	}
+	writer.WriteHeader(http.StatusAccepted)
+	server.respond(writer, "")
+}
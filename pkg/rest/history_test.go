@@ -0,0 +1,54 @@
+package rest
+
+import (
+	"github.com/akleinloog/lazy-rest/pkg/storage"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+func TestHistory(t *testing.T) {
+
+	server := newTestServer(t, WithHistory(storage.Retention{Count: 10}))
+
+	send(t, "PUT", server.URL+"/items/1", `{"name":"First"}`)
+	send(t, "PUT", server.URL+"/items/1", `{"name":"Second"}`, "User-Agent", "history-test")
+	send(t, "DELETE", server.URL+"/items/1", "")
+
+	response, body := send(t, "GET", server.URL+"/items/1?_history", "")
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Contains(t, body, `"userAgent":"history-test"`)
+	assert.Contains(t, body, `"operation":"delete"`)
+
+	response, body = send(t, "GET", server.URL+"/items/1?_version=1", "")
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.JSONEq(t, `{"id":"1","name":"First"}`, body)
+
+	response, _ = send(t, "GET", server.URL+"/items/1?_version=3", "")
+	assert.Equal(t, http.StatusGone, response.StatusCode)
+
+	response, _ = send(t, "GET", server.URL+"/items/1?_version=9", "")
+	assert.Equal(t, http.StatusNotFound, response.StatusCode)
+
+	response, _ = send(t, "GET", server.URL+"/items/1?_version=first", "")
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+
+	response, _ = send(t, "POST", server.URL+"/items/1?_restore=2", "")
+	assert.Equal(t, http.StatusAccepted, response.StatusCode)
+
+	_, body = send(t, "GET", server.URL+"/items/1", "")
+	assert.JSONEq(t, `{"id":"1","name":"Second"}`, body)
+
+	_, body = send(t, "GET", server.URL+"/items/1?_history&format=csv", "")
+	assert.Contains(t, body, "restoredFrom")
+}
+
+func TestHistoryIsNotKeptByDefault(t *testing.T) {
+
+	server := newTestServer(t)
+
+	send(t, "PUT", server.URL+"/items/1", `{"name":"First"}`)
+
+	response, _ := send(t, "GET", server.URL+"/items/1?_history", "")
+	assert.Equal(t, http.StatusNotFound, response.StatusCode)
+}
@@ -4,17 +4,17 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"github.com/akleinloog/lazy-rest/app"
 	"github.com/akleinloog/lazy-rest/pkg/logger"
 	"io/ioutil"
 	"net"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"unicode/utf8"
 )
 
 // initRequestLog initializes a new log entry for a request.
-func initRequestLog(request *http.Request) *logger.RequestLog {
+func (server *Server) initRequestLog(request *http.Request) *logger.RequestLog {
 
 	host := request.Host
 	if host == "" && request.URL != nil {
@@ -23,22 +23,11 @@ func initRequestLog(request *http.Request) *logger.RequestLog {
 
 	body, err := ioutil.ReadAll(request.Body)
 	if err != nil {
-		app.Log.Error(err, "Unable to read request body")
+		server.log.Error(err, "Unable to read request body")
 	} else {
-
-		request.Header.Get("content-type")
-
-		var f interface{}
-		err := json.Unmarshal(body, &f)
-		if err != nil {
-			body = []byte(fmt.Sprintf("%q", body))
-		}
-
 		request.Body = ioutil.NopCloser(bytes.NewBuffer(body))
 	}
 
-	//requestBody := fmt.Sprintf("%q", body)
-
 	logEntry := &logger.RequestLog{
 		Host:        host,
 		Method:      request.Method,
@@ -47,7 +36,7 @@ func initRequestLog(request *http.Request) *logger.RequestLog {
 		Referer:     request.Referer(),
 		Protocol:    request.Proto,
 		RemoteIP:    ipFromHostPort(request.RemoteAddr),
-		RequestBody: body,
+		RequestBody: loggableBody(body),
 	}
 
 	if localAddress, ok := request.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
@@ -65,11 +54,11 @@ func initRequestLog(request *http.Request) *logger.RequestLog {
 //
 // Alternatively, look at https://github.com/goware/httplog for a more in-depth
 // http-handling logger with structured logging support.
-func requestLogger(next http.Handler) http.Handler {
+func (server *Server) requestLogger(next http.Handler) http.Handler {
 
 	fn := func(writer http.ResponseWriter, request *http.Request) {
 
-		entry := initRequestLog(request)
+		entry := server.initRequestLog(request)
 
 		rec := httptest.NewRecorder()
 
@@ -81,7 +70,7 @@ func requestLogger(next http.Handler) http.Handler {
 				entry.Status = http.StatusOK
 			}
 
-			entry.ResponseBody = rec.Body.Bytes()
+			entry.ResponseBody = loggableBody(rec.Body.Bytes())
 
 			// this copies the recorded response to the response writer
 			for k, v := range rec.HeaderMap {
@@ -90,7 +79,7 @@ func requestLogger(next http.Handler) http.Handler {
 			writer.WriteHeader(rec.Code)
 			rec.Body.WriteTo(writer)
 
-			app.Log.LogRequest(entry)
+			server.log.LogRequest(entry)
 		}()
 
 		next.ServeHTTP(rec, request)
@@ -99,6 +88,23 @@ func requestLogger(next http.Handler) http.Handler {
 	return http.HandlerFunc(fn)
 }
 
+// loggableBody returns a body as JSON for the request log. Text that is not JSON is logged as a string,
+// binary data only by its size.
+func loggableBody(body []byte) []byte {
+
+	if len(body) == 0 || json.Valid(body) {
+		return body
+	}
+
+	text := string(body)
+	if !utf8.Valid(body) {
+		text = fmt.Sprintf("<%d bytes>", len(body))
+	}
+
+	logged, _ := json.Marshal(text)
+	return logged
+}
+
 func ipFromHostPort(hp string) string {
 	h, _, err := net.SplitHostPort(hp)
 	if err != nil {
@@ -110,14 +116,6 @@ func ipFromHostPort(hp string) string {
 	return h
 }
 
-func getURLWithSlashAddedIfNeeded(request *http.Request) string {
-	key := request.URL.Path[1:]
-	if !strings.HasSuffix(key, "/") {
-		return key + "/"
-	}
-	return key
-}
-
 func getURLWithSlashRemovedIfNeeded(request *http.Request) string {
 	key := request.URL.Path[1:]
 	if strings.HasSuffix(key, "/") {
@@ -126,25 +124,65 @@ func getURLWithSlashRemovedIfNeeded(request *http.Request) string {
 	return key
 }
 
-func respondWithContent(writer http.ResponseWriter, message interface{}) {
+// respondWithContent responds with the content in the format that is selected by the request,
+// or with 406 Not Acceptable when none of the formats is acceptable.
+func (server *Server) respondWithContent(writer http.ResponseWriter, request *http.Request, content interface{}) {
 
-	//content, err := json.Marshal(message)
-	//if err != nil {
-	//	server.Log().Error(err, "Error while unmarshalling json")
-	//}
-	//content := fmt.Sprintf("%s", message)
-	// _, err := fmt.Fprint(writer, message)
-	encoder := json.NewEncoder(writer)
-	err := encoder.Encode(message)
+	writer.Header().Add("Vary", "Accept")
+
+	responseFormat, err := responseFormat(request)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusNotAcceptable)
+		return
+	}
+
+	writer.Header().Set("Content-Type", responseFormat.ContentType)
+	err = responseFormat.Encode(writer, content)
 	if err != nil {
-		app.Log.Error(err, "Error while responding to request")
+		server.log.Error(err, "Error while responding to request")
+	}
+}
+
+// The preferences of the Prefer header that are supported.
+const (
+	returnMinimal             = "minimal"
+	returnRepresentation      = "representation"
+	resolutionMergeDuplicates = "merge-duplicates"
+)
+
+// preferencesOf returns the preferences in the Prefer headers of a request, like return=minimal.
+// Preferences without a value, like respond-async, are returned with an empty value.
+func preferencesOf(request *http.Request) map[string]string {
+
+	preferences := make(map[string]string)
+
+	for _, header := range request.Header.Values("Prefer") {
+		for _, preference := range strings.Split(header, ",") {
+			// Parameters of a preference, after a semicolon, are not supported
+			preference = strings.TrimSpace(strings.SplitN(preference, ";", 2)[0])
+			if preference == "" {
+				continue
+			}
+			parts := strings.SplitN(preference, "=", 2)
+			name := strings.ToLower(strings.TrimSpace(parts[0]))
+			if _, present := preferences[name]; present {
+				continue
+			}
+			value := ""
+			if len(parts) == 2 {
+				value = strings.Trim(strings.TrimSpace(parts[1]), `"`)
+			}
+			preferences[name] = value
+		}
 	}
+
+	return preferences
 }
 
-func respond(writer http.ResponseWriter, message string) {
+func (server *Server) respond(writer http.ResponseWriter, message string) {
 
 	_, err := fmt.Fprint(writer, message)
 	if err != nil {
-		app.Log.Error(err, "Error while responding to request")
+		server.log.Error(err, "Error while responding to request")
 	}
 }
@@ -0,0 +1,237 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/akleinloog/lazy-rest/pkg/storage"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sync"
+	"time"
+)
+
+// idempotencyPrefix is the reserved collection that responses to requests with an Idempotency-Key are kept in.
+const idempotencyPrefix = storage.ReservedPrefix + "idempotency"
+
+// defaultIdempotencyWindow is how long responses to requests with an Idempotency-Key are remembered by default.
+const defaultIdempotencyWindow = 24 * time.Hour
+
+// WithIdempotencyWindow sets how long the server remembers the responses to POST requests with an Idempotency-Key,
+// by default a day. Within this window, retries get the original response. A window of 0 or less disables this.
+func WithIdempotencyWindow(window time.Duration) Option {
+	return func(server *Server) {
+		server.idempotencyWindow = window
+	}
+}
+
+// idempotencyRecord is the response to a request with an Idempotency-Key, as it is kept in the store.
+type idempotencyRecord struct {
+	RequestHash string      `json:"requestHash"`
+	Status      int         `json:"status"`
+	Header      http.Header `json:"header"`
+	Body        []byte      `json:"body"`
+	Expires     time.Time   `json:"expires"`
+}
+
+// idempotency remembers the responses to requests with an Idempotency-Key in a store,
+// which survive restarts when the store keeps its documents on disk.
+type idempotency struct {
+	store      storage.Store
+	window     time.Duration
+	mutex      sync.Mutex
+	inProgress map[string]bool
+	lastPruned time.Time
+}
+
+func newIdempotency(store storage.Store, window time.Duration) *idempotency {
+	return &idempotency{store: store, window: window, inProgress: make(map[string]bool)}
+}
+
+// idempotent handles a request once per Idempotency-Key, and responds to retries with the original response.
+// Requests without the header are handled as they are.
+func (server *Server) idempotent(writer http.ResponseWriter, request *http.Request, handle http.HandlerFunc) {
+
+	idempotencyKey := request.Header.Get("Idempotency-Key")
+	if server.idempotency == nil || idempotencyKey == "" {
+		handle(writer, request)
+		return
+	}
+
+	body, err := ioutil.ReadAll(request.Body)
+	if err != nil {
+		http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	request.Body = ioutil.NopCloser(bytes.NewBuffer(body))
+
+	recordKey := idempotencyRecordKey(idempotencyKey)
+	if !server.idempotency.start(recordKey) {
+		http.Error(writer, fmt.Sprintf("A request with Idempotency-Key `%s` is still in progress", idempotencyKey), http.StatusConflict)
+		return
+	}
+	defer server.idempotency.finish(recordKey)
+
+	requestHash := hashRequest(request, body)
+
+	record, exists, err := server.idempotency.get(request.Context(), recordKey)
+	if err != nil {
+		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if exists {
+		if record.RequestHash != requestHash {
+			http.Error(writer, fmt.Sprintf("Idempotency-Key `%s` was already used for a different request", idempotencyKey), http.StatusUnprocessableEntity)
+			return
+		}
+		record.replay(writer)
+		return
+	}
+
+	recorder := httptest.NewRecorder()
+	handle(recorder, request)
+
+	// Failures of the server itself are not remembered, so they can be retried
+	if recorder.Code < http.StatusInternalServerError {
+		err = server.idempotency.put(request.Context(), recordKey, &idempotencyRecord{
+			RequestHash: requestHash,
+			Status:      recorder.Code,
+			Header:      recorder.Header(),
+			Body:        recorder.Body.Bytes(),
+			Expires:     time.Now().Add(server.idempotency.window),
+		})
+		if err != nil {
+			server.log.Error(err, "Unable to remember the response to a request with an Idempotency-Key")
+		}
+	}
+
+	for name, values := range recorder.Header() {
+		writer.Header()[name] = values
+	}
+	writer.WriteHeader(recorder.Code)
+	server.respond(writer, recorder.Body.String())
+}
+
+// idempotencyRecordKey returns the key the response to a request with the Idempotency-Key is kept at.
+func idempotencyRecordKey(idempotencyKey string) string {
+	hash := sha256.Sum256([]byte(idempotencyKey))
+	return path.Join(idempotencyPrefix, hex.EncodeToString(hash[:]))
+}
+
+// hashRequest returns a hash of what was requested, to recognize an Idempotency-Key that is used for another request.
+func hashRequest(request *http.Request, body []byte) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s %s\n%s\n", request.Method, request.URL.RequestURI(), request.Header.Get("Content-Type"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// replay responds with the remembered response.
+func (record *idempotencyRecord) replay(writer http.ResponseWriter) {
+
+	for name, values := range record.Header {
+		writer.Header()[name] = values
+	}
+	writer.Header().Set("Idempotent-Replayed", "true")
+	writer.WriteHeader(record.Status)
+	writer.Write(record.Body)
+}
+
+// start marks a request with the key as in progress, and indicates if no other request with the key was.
+func (remembered *idempotency) start(key string) bool {
+
+	remembered.mutex.Lock()
+	defer remembered.mutex.Unlock()
+
+	if remembered.inProgress[key] {
+		return false
+	}
+	remembered.inProgress[key] = true
+
+	return true
+}
+
+// finish marks a request with the key as completed.
+func (remembered *idempotency) finish(key string) {
+
+	remembered.mutex.Lock()
+	defer remembered.mutex.Unlock()
+
+	delete(remembered.inProgress, key)
+}
+
+// get returns the remembered response at the key, and indicates if it exists and has not expired.
+func (remembered *idempotency) get(ctx context.Context, key string) (*idempotencyRecord, bool, error) {
+
+	document, exists, err := remembered.store.Get(ctx, key)
+	if err != nil || !exists {
+		return nil, false, err
+	}
+
+	record, err := toIdempotencyRecord(document)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return record, time.Now().Before(record.Expires), nil
+}
+
+// put remembers the response at the key, and forgets responses that have expired.
+func (remembered *idempotency) put(ctx context.Context, key string, record *idempotencyRecord) error {
+
+	var content interface{}
+	err := storage.Convert(record, &content)
+	if err != nil {
+		return err
+	}
+
+	_, err = remembered.store.Put(ctx, key, content)
+	if err != nil {
+		return err
+	}
+
+	return remembered.prune(ctx)
+}
+
+// prune forgets responses that have expired, at most once a minute.
+func (remembered *idempotency) prune(ctx context.Context) error {
+
+	remembered.mutex.Lock()
+	if time.Since(remembered.lastPruned) < time.Minute {
+		remembered.mutex.Unlock()
+		return nil
+	}
+	remembered.lastPruned = time.Now()
+	remembered.mutex.Unlock()
+
+	documents, err := remembered.store.List(ctx, idempotencyPrefix)
+	if err != nil {
+		return err
+	}
+
+	for _, document := range documents {
+		record, err := toIdempotencyRecord(document)
+		if err == nil && time.Now().Before(record.Expires) {
+			continue
+		}
+		_, err = remembered.store.Delete(ctx, document.Key)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// toIdempotencyRecord converts a stored document into the response it remembers.
+func toIdempotencyRecord(document *storage.Document) (*idempotencyRecord, error) {
+
+	var record idempotencyRecord
+	err := storage.Convert(document.Content, &record)
+	return &record, err
+}
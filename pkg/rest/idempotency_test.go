@@ -0,0 +1,97 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/akleinloog/lazy-rest/pkg/storage"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+)
+
+func decodeArray(t *testing.T, body string) []interface{} {
+	var array []interface{}
+	assert.NoError(t, json.Unmarshal([]byte(body), &array), "Response should be a JSON array")
+	return array
+}
+
+func TestIdempotencyKeyReplaysTheResponse(t *testing.T) {
+
+	server := newTestServer(t)
+
+	response, body := send(t, "POST", server.URL+"/items", `{"name":"First"}`, "Idempotency-Key", "abc")
+	assert.Equal(t, http.StatusCreated, response.StatusCode)
+	location := response.Header.Get("Location")
+
+	replayed, replayedBody := send(t, "POST", server.URL+"/items", `{"name":"First"}`, "Idempotency-Key", "abc")
+	assert.Equal(t, http.StatusCreated, replayed.StatusCode)
+	assert.Equal(t, "true", replayed.Header.Get("Idempotent-Replayed"))
+	assert.Equal(t, location, replayed.Header.Get("Location"), "A retry should not create another item")
+	assert.Equal(t, body, replayedBody)
+
+	_, body = send(t, "GET", server.URL+"/items", "")
+	assert.Equal(t, 1, len(decodeArray(t, body)))
+
+	response, _ = send(t, "POST", server.URL+"/items", `{"name":"Other"}`, "Idempotency-Key", "abc")
+	assert.Equal(t, http.StatusUnprocessableEntity, response.StatusCode, "A key should not be reused for another request")
+
+	response, _ = send(t, "POST", server.URL+"/items", `{"name":"First"}`, "Idempotency-Key", "def")
+	assert.Equal(t, http.StatusCreated, response.StatusCode)
+	assert.Empty(t, response.Header.Get("Idempotent-Replayed"))
+}
+
+func TestIdempotencyKeysCanBeDisabled(t *testing.T) {
+
+	server := newTestServer(t, WithIdempotencyWindow(0))
+
+	send(t, "POST", server.URL+"/items", `{"name":"First"}`, "Idempotency-Key", "abc")
+	send(t, "POST", server.URL+"/items", `{"name":"First"}`, "Idempotency-Key", "abc")
+
+	_, body := send(t, "GET", server.URL+"/items", "")
+	assert.Equal(t, 2, len(decodeArray(t, body)))
+}
+
+func TestIdempotencyKeysSurviveRestarts(t *testing.T) {
+
+	directory, err := ioutil.TempDir("", "lazy-rest")
+	if !assert.NoError(t, err, "Error occurred while creating test directory") {
+		return
+	}
+	defer os.RemoveAll(directory)
+
+	store, err := storage.NewFileStore(directory)
+	if !assert.NoError(t, err) {
+		return
+	}
+	server := newTestServer(t, WithStore(store))
+	response, _ := send(t, "POST", server.URL+"/items", `{"name":"First"}`, "Idempotency-Key", "abc")
+	location := response.Header.Get("Location")
+	server.Close()
+
+	store, err = storage.NewFileStore(directory)
+	if !assert.NoError(t, err) {
+		return
+	}
+	restarted := newTestServer(t, WithStore(store))
+	response, _ = send(t, "POST", restarted.URL+"/items", `{"name":"First"}`, "Idempotency-Key", "abc")
+	assert.Equal(t, "true", response.Header.Get("Idempotent-Replayed"))
+	assert.Equal(t, location, response.Header.Get("Location"))
+
+	_, body := send(t, "GET", restarted.URL+"/items", "")
+	assert.Equal(t, 1, len(decodeArray(t, body)), "Remembered responses should not show up in collections")
+}
+
+func TestExpiredIdempotencyKeysAreForgotten(t *testing.T) {
+
+	remembered := newIdempotency(storage.NewMemoryStore(), defaultIdempotencyWindow)
+	key := idempotencyRecordKey("abc")
+
+	err := remembered.put(context.Background(), key, &idempotencyRecord{RequestHash: "hash", Status: http.StatusCreated})
+	assert.NoError(t, err)
+
+	_, exists, err := remembered.get(context.Background(), key)
+	assert.NoError(t, err)
+	assert.False(t, exists, "Expired responses should not be replayed")
+}
@@ -0,0 +1,268 @@
+package rest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"github.com/akleinloog/lazy-rest/pkg/storage"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// The supported id strategies, slug takes the field to derive the id from as slug:field, by default the name.
+const (
+	IDRandom   = "random"
+	IDUUID     = "uuid"
+	IDULID     = "ulid"
+	IDSequence = "sequence"
+	IDSlug     = "slug"
+)
+
+// idStrategy generates ids for objects that are added to a collection without one.
+type idStrategy interface {
+	generate(ctx context.Context, collection string, content interface{}) (string, error)
+}
+
+// WithIDField sets the name of the field that holds the id of objects, by default id.
+func WithIDField(name string) Option {
+	return func(server *Server) {
+		server.idField = name
+	}
+}
+
+// WithIDStrategy sets how ids are generated for objects without one: random (the default), uuid, ulid (sortable),
+// sequence (integers per collection), or slug:field to derive it from a field of the object.
+func WithIDStrategy(strategy string) Option {
+	return func(server *Server) {
+		server.idStrategies[""] = strategy
+	}
+}
+
+// WithIDStrategyFor sets how ids are generated for collections below a path prefix, like /users.
+// The strategy of the longest matching prefix is used.
+func WithIDStrategyFor(prefix string, strategy string) Option {
+	return func(server *Server) {
+		server.idStrategies[strings.Trim(prefix, "/")] = strategy
+	}
+}
+
+// ids selects the strategy to generate ids with, per path prefix.
+type ids struct {
+	strategies map[string]idStrategy
+	prefixes   []string
+}
+
+// newIDs parses the strategies per prefix, the empty prefix holds the default strategy.
+func newIDs(strategies map[string]string, store storage.Store) (*ids, error) {
+
+	selection := &ids{strategies: make(map[string]idStrategy)}
+
+	for prefix, name := range strategies {
+		strategy, err := parseIDStrategy(name, store)
+		if err != nil {
+			return nil, err
+		}
+		selection.strategies[prefix] = strategy
+		selection.prefixes = append(selection.prefixes, prefix)
+	}
+
+	if _, present := selection.strategies[""]; !present {
+		selection.strategies[""] = randomIDs{}
+		selection.prefixes = append(selection.prefixes, "")
+	}
+
+	// Longest prefixes first, so the most specific strategy is found first
+	sort.Slice(selection.prefixes, func(i, j int) bool {
+		return len(selection.prefixes[i]) > len(selection.prefixes[j])
+	})
+
+	return selection, nil
+}
+
+// parseIDStrategy returns the strategy with the name.
+func parseIDStrategy(name string, store storage.Store) (idStrategy, error) {
+
+	switch {
+	case name == IDRandom:
+		return randomIDs{}, nil
+	case name == IDUUID:
+		return uuids{}, nil
+	case name == IDULID:
+		return &ulids{}, nil
+	case name == IDSequence:
+		return &sequences{store: store, last: make(map[string]int)}, nil
+	case name == IDSlug:
+		return slugs{field: "name"}, nil
+	case strings.HasPrefix(name, IDSlug+":") && len(name) > len(IDSlug)+1:
+		return slugs{field: strings.TrimPrefix(name, IDSlug+":")}, nil
+	default:
+		return nil, fmt.Errorf("unknown id strategy `%s`, use %s, %s, %s, %s or %s:field", name, IDRandom, IDUUID, IDULID, IDSequence, IDSlug)
+	}
+}
+
+// generate generates an id for content that is added to the collection.
+func (selection *ids) generate(ctx context.Context, collection string, content interface{}) (string, error) {
+
+	collection = strings.Trim(collection, "/")
+
+	for _, prefix := range selection.prefixes {
+		if prefix == "" || collection == prefix || strings.HasPrefix(collection, prefix+"/") {
+			return selection.strategies[prefix].generate(ctx, collection, content)
+		}
+	}
+
+	return selection.strategies[""].generate(ctx, collection, content)
+}
+
+// randomIDs generates 10 random bytes, encoded as base64url.
+type randomIDs struct{}
+
+func (randomIDs) generate(context.Context, string, interface{}) (string, error) {
+	return createId(), nil
+}
+
+// uuids generates random UUIDs, version 4.
+type uuids struct{}
+
+func (uuids) generate(context.Context, string, interface{}) (string, error) {
+
+	random := make([]byte, 16)
+	_, err := io.ReadFull(rand.Reader, random)
+	if err != nil {
+		return "", err
+	}
+
+	random[6] = (random[6] & 0x0f) | 0x40
+	random[8] = (random[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", random[0:4], random[4:6], random[6:8], random[8:10], random[10:16]), nil
+}
+
+// ulids generates ULIDs, which sort in the order they are generated, also within the same millisecond.
+type ulids struct {
+	mutex    sync.Mutex
+	lastTime uint64
+	random   [10]byte
+}
+
+// crockford is the alphabet of ULIDs.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+func (generator *ulids) generate(context.Context, string, interface{}) (string, error) {
+
+	generator.mutex.Lock()
+	defer generator.mutex.Unlock()
+
+	now := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+
+	if now > generator.lastTime {
+		generator.lastTime = now
+		_, err := io.ReadFull(rand.Reader, generator.random[:])
+		if err != nil {
+			return "", err
+		}
+	} else {
+		// Increment the random part, so ids within the same millisecond still sort in order
+		for index := len(generator.random) - 1; index >= 0; index-- {
+			generator.random[index]++
+			if generator.random[index] != 0 {
+				break
+			}
+		}
+	}
+
+	var value [16]byte
+	binary.BigEndian.PutUint16(value[0:2], uint16(generator.lastTime>>32))
+	binary.BigEndian.PutUint32(value[2:6], uint32(generator.lastTime))
+	copy(value[6:], generator.random[:])
+
+	// 128 bits are encoded as 26 characters of 5 bits, the first character only holds 3 bits
+	id := make([]byte, 26)
+	for index := 25; index >= 0; index-- {
+		bit := (25 - index) * 5
+		var chunk uint
+		for offset := 0; offset < 5; offset++ {
+			position := bit + offset
+			if position < 128 && value[15-position/8]&(1<<uint(position%8)) != 0 {
+				chunk |= 1 << uint(offset)
+			}
+		}
+		id[index] = crockford[chunk]
+	}
+
+	return string(id), nil
+}
+
+// sequences generates integers per collection, continuing after the highest integer id in the collection.
+type sequences struct {
+	store storage.Store
+	mutex sync.Mutex
+	last  map[string]int
+}
+
+func (generator *sequences) generate(ctx context.Context, collection string, _ interface{}) (string, error) {
+
+	generator.mutex.Lock()
+	defer generator.mutex.Unlock()
+
+	documents, err := generator.store.List(ctx, collection)
+	if err != nil {
+		return "", err
+	}
+
+	last := generator.last[collection]
+	for _, document := range documents {
+		if number, err := strconv.Atoi(path.Base(document.Key)); err == nil && number > last {
+			last = number
+		}
+	}
+
+	generator.last[collection] = last + 1
+	return strconv.Itoa(last + 1), nil
+}
+
+// slugs derives ids from a field of the object, like `My First Item` into my-first-item.
+type slugs struct {
+	field string
+}
+
+func (generator slugs) generate(_ context.Context, _ string, content interface{}) (string, error) {
+
+	object, _ := content.(map[string]interface{})
+	value, isString := object[generator.field].(string)
+	slug := slugify(value)
+
+	if !isString || slug == "" {
+		return "", fmt.Errorf("Unable to derive an id from field `%s`, it should hold text", generator.field)
+	}
+
+	return slug, nil
+}
+
+// slugify converts text into lower case letters and digits separated by dashes.
+func slugify(text string) string {
+
+	var slug strings.Builder
+	dash := false
+
+	for _, character := range strings.ToLower(text) {
+		if unicode.IsLetter(character) || unicode.IsDigit(character) {
+			if dash && slug.Len() > 0 {
+				slug.WriteByte('-')
+			}
+			slug.WriteRune(character)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+
+	return slug.String()
+}
@@ -0,0 +1,122 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/akleinloog/lazy-rest/pkg/storage"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"regexp"
+	"testing"
+)
+
+func TestUUIDs(t *testing.T) {
+
+	id, err := uuids{}.generate(context.Background(), "items", nil)
+	assert.NoError(t, err)
+	assert.Regexp(t, regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`), id)
+}
+
+func TestULIDsSortInOrder(t *testing.T) {
+
+	generator := &ulids{}
+	previous := ""
+
+	for index := 0; index < 100; index++ {
+		id, err := generator.generate(context.Background(), "items", nil)
+		assert.NoError(t, err)
+		assert.Len(t, id, 26)
+		assert.Regexp(t, regexp.MustCompile(`^[0-9A-HJKMNP-TV-Z]+$`), id)
+		assert.True(t, id > previous, "ULIDs should sort in the order they are generated")
+		previous = id
+	}
+}
+
+func TestSequences(t *testing.T) {
+
+	store := storage.NewMemoryStore()
+	_, err := store.Put(context.Background(), "items/7", map[string]interface{}{"id": "7"})
+	assert.NoError(t, err)
+	_, err = store.Put(context.Background(), "items/other", map[string]interface{}{"id": "other"})
+	assert.NoError(t, err)
+
+	generator := &sequences{store: store, last: make(map[string]int)}
+
+	id, _ := generator.generate(context.Background(), "items", nil)
+	assert.Equal(t, "8", id, "Sequences should continue after the highest id in the collection")
+	id, _ = generator.generate(context.Background(), "items", nil)
+	assert.Equal(t, "9", id, "Sequences should not hand out the same id twice")
+	id, _ = generator.generate(context.Background(), "others", nil)
+	assert.Equal(t, "1", id, "Every collection should have its own sequence")
+}
+
+func TestSlugs(t *testing.T) {
+
+	id, err := slugs{field: "title"}.generate(context.Background(), "posts", map[string]interface{}{"title": "  Hello, World! Ünïcode 2020 "})
+	assert.NoError(t, err)
+	assert.Equal(t, "hello-world-ünïcode-2020", id)
+
+	_, err = slugs{field: "title"}.generate(context.Background(), "posts", map[string]interface{}{"title": 42.0})
+	assert.Error(t, err, "Slugs should only be derived from text")
+}
+
+func TestUnknownIDStrategy(t *testing.T) {
+
+	_, err := New(WithIDStrategy("counter"), WithLogger(&quietLog))
+	assert.Error(t, err, "Unknown id strategies should not be accepted")
+
+	_, err = New(WithIDField(""), WithLogger(&quietLog))
+	assert.Error(t, err, "The id field should have a name")
+}
+
+func TestIDStrategyPerPrefix(t *testing.T) {
+
+	server := newTestServer(t, WithIDStrategy(IDUUID), WithIDStrategyFor("/users", IDSequence), WithIDStrategyFor("posts", "slug:title"))
+
+	response, _ := send(t, "POST", server.URL+"/users", `[{"name":"Alice"},{"name":"Bob"}]`)
+	assert.Equal(t, http.StatusCreated, response.StatusCode)
+	_, body := send(t, "GET", server.URL+"/users?sort=name", "")
+	assert.JSONEq(t, `[{"id":"1","name":"Alice"},{"id":"2","name":"Bob"}]`, body)
+
+	response, _ = send(t, "POST", server.URL+"/posts", `{"title":"My First Post"}`)
+	assert.Equal(t, http.StatusCreated, response.StatusCode)
+	response, _ = send(t, "GET", server.URL+"/posts/my-first-post", "")
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+
+	response, _ = send(t, "POST", server.URL+"/posts", `{"body":"No title"}`)
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode, "A slug needs the field to derive it from")
+
+	send(t, "POST", server.URL+"/items", `{"name":"Something"}`)
+	_, body = send(t, "GET", server.URL+"/items", "")
+	var items []map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(body), &items))
+	if assert.Len(t, items, 1) {
+		assert.Len(t, items[0]["id"], 36, "Other collections should use the default strategy")
+	}
+}
+
+func TestCustomIDField(t *testing.T) {
+
+	server := newTestServer(t, WithIDField("_id"))
+
+	response, _ := send(t, "PUT", server.URL+"/items/1", `{"name":"First"}`)
+	assert.Equal(t, http.StatusAccepted, response.StatusCode)
+	_, body := send(t, "GET", server.URL+"/items/1", "")
+	assert.JSONEq(t, `{"_id":"1","name":"First"}`, body)
+
+	response, body = send(t, "PUT", server.URL+"/items/1", `{"_id":"2","name":"First"}`)
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+	assert.Contains(t, body, "Mismatch between _id field `2` and address `1`")
+
+	response, _ = send(t, "PUT", server.URL+"/items/2", `{"id":"something else","name":"Second"}`)
+	assert.Equal(t, http.StatusAccepted, response.StatusCode, "The id field should not be special anymore")
+
+	send(t, "POST", server.URL+"/others", `{"name":"Posted"}`)
+	_, body = send(t, "GET", server.URL+"/others", "")
+	var items []map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(body), &items))
+	if assert.Len(t, items, 1) {
+		assert.NotEmpty(t, items[0]["_id"])
+		assert.NotContains(t, items[0], "id")
+	}
+}
@@ -0,0 +1,82 @@
+package rest
+
+import (
+	"errors"
+	"fmt"
+	"github.com/akleinloog/lazy-rest/pkg/storage"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// checkPath checks that the path of a request is a key that clients can use, and returns the reason when it is not.
+// Paths can not refer to other collections with `..`, and names starting with a dot are reserved for the server.
+func checkPath(request *http.Request) error {
+
+	if !strings.HasPrefix(request.URL.Path, "/") {
+		return fmt.Errorf("Invalid path `%s`, it should start with a slash", request.URL.Path)
+	}
+
+	key := strings.TrimSuffix(request.URL.Path[1:], "/")
+
+	err := checkKey(key)
+	if err != nil {
+		return fmt.Errorf("Invalid path `/%s`, %s", key, err.Error())
+	}
+
+	return nil
+}
+
+// errRootDocument is the reason documents can not be stored at the root key, which is the collection that holds all others.
+var errRootDocument = errors.New("The root is a collection, only an array of items can be PUT to `/`")
+
+// idName returns the name an item is stored under for the value of its id field.
+// Numbers are written out in full, so 1500 and 1.5e3 are the same item and 1000000 is not stored as 1e+06.
+func idName(id interface{}) string {
+
+	if number, isNumber := id.(float64); isNumber {
+		return strconv.FormatFloat(number, 'f', -1, 64)
+	}
+
+	return fmt.Sprintf("%v", id)
+}
+
+// checkId checks that clients can use a name as id, and returns the reason when they can not.
+func checkId(name string) error {
+
+	if name == "" {
+		return errors.New("it is empty")
+	}
+	if strings.Contains(name, "/") {
+		return errors.New("it contains a slash")
+	}
+
+	return checkKey(name)
+}
+
+// checkKey returns the reason clients can not use a key, or nil when they can.
+func checkKey(key string) error {
+
+	var keyError *storage.KeyError
+	if err := storage.CheckKey(key); errors.As(err, &keyError) {
+		return errors.New(keyError.Reason)
+	}
+
+	if key == "" {
+		return nil
+	}
+
+	for _, segment := range strings.Split(key, "/") {
+		if storage.IsReserved(segment) {
+			return errors.New("names starting with a dot are reserved")
+		}
+	}
+
+	return nil
+}
+
+// locationOf returns the location of the document at the key, with its path escaped for use in headers.
+func locationOf(key string) string {
+	return (&url.URL{Path: "/" + key}).EscapedPath()
+}
@@ -0,0 +1,95 @@
+package rest
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestHostilePathsAreRejected(t *testing.T) {
+
+	server := newTestServer(t)
+
+	paths := []string{
+		"/items/%2E%2E/%2E%2E/etc/passwd",
+		"/items/..%2F..%2Fescaped",
+		"/%2E%2E",
+		"/items/.%2Fx",
+		"/.history/items/1",
+		"/items/.1.meta",
+		"/items/%00",
+		"/items//1",
+		"/items/" + strings.Repeat("x", 300),
+	}
+
+	for _, path := range paths {
+		for _, method := range []string{"GET", "PUT", "POST", "PATCH", "DELETE"} {
+			response, _ := send(t, method, server.URL+path, `{"name":"Hostile"}`)
+			assert.Equal(t, http.StatusBadRequest, response.StatusCode, "%s %s should be rejected", method, path)
+		}
+	}
+
+	// The root is the collection that holds all others, not a document
+	for _, method := range []string{"PUT", "PATCH"} {
+		response, _ := send(t, method, server.URL+"/", `{"name":"Hostile"}`, "Content-Type", mergePatchContentType)
+		assert.Equal(t, http.StatusBadRequest, response.StatusCode, "%s / should be rejected", method)
+	}
+	response, _ := send(t, "PUT", server.URL+"/", "text", "Content-Type", "text/plain")
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode, "Data should not be stored at the root")
+
+	response, _ = send(t, "PUT", server.URL+"/", `[{"id":"1"}]`)
+	assert.Equal(t, http.StatusAccepted, response.StatusCode, "The root collection should be replaced with an array")
+	_, body := send(t, "GET", server.URL+"/", "")
+	assert.JSONEq(t, `[{"id":"1"}]`, body)
+}
+
+func TestHostileIdsAreRejected(t *testing.T) {
+
+	server := newTestServer(t)
+
+	ids := []string{`../../escaped`, `a/b`, `..`, `.`, `.hidden`, `a\u0000b`, ``}
+
+	for _, id := range ids {
+		response, body := send(t, "POST", server.URL+"/items", `{"id":"`+id+`"}`)
+		assert.Equal(t, http.StatusBadRequest, response.StatusCode, "Id `%s` should be rejected", id)
+		assert.Contains(t, body, "invalid id")
+
+		response, _ = send(t, "PUT", server.URL+"/items/", `[{"id":"`+id+`"}]`)
+		assert.Equal(t, http.StatusBadRequest, response.StatusCode, "Id `%s` should be rejected in collections", id)
+	}
+
+	response, _ := send(t, "GET", server.URL+"/items", "")
+	assert.Equal(t, http.StatusNotFound, response.StatusCode, "Nothing should be stored")
+}
+
+func TestUnusualIdsAreStored(t *testing.T) {
+
+	server := newTestServer(t)
+
+	for _, id := range []string{"CON", "a:b", "100%", "50% off", "trailing.", "名前", "a?b#c"} {
+		response, _ := send(t, "POST", server.URL+"/items", `{"id":"`+id+`"}`)
+		if assert.Equal(t, http.StatusCreated, response.StatusCode, "Id `%s` should be accepted", id) {
+			response, _ = send(t, "GET", server.URL+response.Header.Get("Location"), "")
+			assert.Equal(t, http.StatusOK, response.StatusCode, "Id `%s` should be found at its location", id)
+		}
+	}
+}
+
+func TestNumericIds(t *testing.T) {
+
+	server := newTestServer(t, WithIDStrategy(IDSequence))
+
+	response, _ := send(t, "POST", server.URL+"/items", `{"id":1000000}`)
+	assert.Equal(t, http.StatusCreated, response.StatusCode)
+	assert.Equal(t, "/items/1000000", response.Header.Get("Location"), "Numbers should not be stored in exponent notation")
+
+	response, _ = send(t, "PUT", server.URL+"/items/", `[{"id":1500},{"id":1.5e3}]`)
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode, "The same number should be the same id")
+
+	response, _ = send(t, "PUT", server.URL+"/items/1.5", `{"id":1.5}`)
+	assert.Equal(t, http.StatusAccepted, response.StatusCode, "Numeric ids should match the address")
+
+	response, _ = send(t, "POST", server.URL+"/items", `{"name":"Next"}`)
+	assert.Equal(t, "/items/1000001", response.Header.Get("Location"), "Sequences should continue after numeric ids")
+}
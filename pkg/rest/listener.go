@@ -1,52 +1,139 @@
 package rest
 
 import (
-	"fmt"
-	"github.com/akleinloog/lazy-rest/app"
+	"context"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 )
 
 var (
 	host = "unknown"
 )
 
-func Listen() {
+// Listen starts accepting requests, and blocks until the process receives SIGINT or SIGTERM.
+// Requests that are in progress are then given the shutdown timeout to complete.
+func (server *Server) Listen() {
 
 	currentHost, err := os.Hostname()
 	if err != nil {
-		app.Log.Info().Msgf("Could not determine host name:", err)
+		server.log.Error(err, "Could not determine host name")
 	} else {
 		host = currentHost
 	}
 
-	app.Log.Info().Msgf("Starting Lazy REST Server on " + host)
+	server.log.Info().Msgf("Starting Lazy REST Server on " + host)
 
-	requestHandler := http.HandlerFunc(HandleRequest)
+	err = server.listen()
+	if err != nil {
+		server.log.Fatal(err, "Error while listening for requests")
+	}
 
-	http.Handle("/", requestLogger(requestHandler))
+	stopped := server.serve()
+
+	for _, url := range server.URLs() {
+		server.log.Info().Str("url", url).Msg("Listening for requests")
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	select {
+	case err = <-stopped:
+		if err != nil {
+			server.log.Fatal(err, "Error while listening for requests")
+		}
+		return
+	case received := <-signals:
+		server.log.Info().
+			Str("signal", received.String()).
+			Dur("timeout", server.timeouts.Shutdown).
+			Msg("Shutting down, waiting for requests in progress to complete")
+	}
 
-	address := fmt.Sprintf("%s:%d", "", app.Config.Port())
+	ctx, cancel := context.WithTimeout(context.Background(), server.timeouts.Shutdown)
+	defer cancel()
 
-	err = http.ListenAndServe(address, nil)
+	err = server.Shutdown(ctx)
 	if err != nil {
-		app.Log.Fatal(err, "Error while listening for requests")
+		server.log.Error(err, "Requests in progress did not complete in time")
+		return
 	}
+
+	server.log.Info().Msg("Lazy REST Server stopped")
 }
 
 // HandleRequest determines the appropriate action to take based on the http method.
-func HandleRequest(writer http.ResponseWriter, request *http.Request) {
+func (server *Server) HandleRequest(writer http.ResponseWriter, request *http.Request) {
+
+	request = withChange(request)
+
+	err := checkPath(request)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	allowed := server.allowedMethods(request)
+	if !isAllowed(allowed, request.Method) {
+		writer.Header().Set("Allow", strings.Join(allowed, ", "))
+		http.Error(writer, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	if isSchemasPath(request.URL.Path) && request.Method != "HEAD" && request.Method != "OPTIONS" {
+		server.handleSchemas(writer, request)
+		return
+	}
+
+	if keys := lockKeys(request); len(keys) > 0 {
+		unlock := server.locks.lock(keys...)
+		defer unlock()
+	}
 
 	switch request.Method {
 	case "GET":
-		handleGET(writer, request)
+		server.handleGET(writer, request)
+	case "HEAD":
+		server.handleHEAD(writer, request)
+	case "OPTIONS":
+		writer.Header().Set("Allow", strings.Join(allowed, ", "))
+		writer.WriteHeader(http.StatusNoContent)
 	case "POST":
-		handlePOST(writer, request)
+		server.idempotent(writer, request, server.handlePOST)
 	case "PUT":
-		handlePUT(writer, request)
+		server.handlePUT(writer, request)
+	case "PATCH":
+		server.handlePATCH(writer, request)
 	case "DELETE":
-		handleDELETE(writer, request)
-	default:
-		http.Error(writer, http.StatusText(http.StatusNotImplemented), http.StatusNotImplemented)
+		server.handleDELETE(writer, request)
+	}
+}
+
+// allowedMethods returns the methods that can be used on the path of a request. Only reading methods are allowed on
+// the endpoints of the server itself, and on all paths when the server is read-only.
+func (server *Server) allowedMethods(request *http.Request) []string {
+
+	if server.readOnly || request.URL.Path == collectionsPath {
+		return []string{"GET", "HEAD", "OPTIONS"}
+	}
+
+	if isSchemasPath(request.URL.Path) {
+		return []string{"GET", "HEAD", "PUT", "DELETE", "OPTIONS"}
+	}
+
+	return []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+}
+
+// isAllowed indicates if the method is one of the allowed methods.
+func isAllowed(allowed []string, method string) bool {
+	for _, candidate := range allowed {
+		if candidate == method {
+			return true
+		}
 	}
+	return false
 }
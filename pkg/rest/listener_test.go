@@ -0,0 +1,105 @@
+package rest
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestHeadItem(t *testing.T) {
+
+	server := newTestServer(t)
+	send(t, "PUT", server.URL+"/items/1", `{"id":"1","name":"first"}`)
+
+	get, body := send(t, "GET", server.URL+"/items/1", "")
+	head, headBody := send(t, "HEAD", server.URL+"/items/1", "")
+
+	assert.Equal(t, http.StatusOK, head.StatusCode)
+	assert.Empty(t, headBody, "HEAD should not return a body")
+	assert.Equal(t, strconv.Itoa(len(body)), head.Header.Get("Content-Length"))
+	assert.Equal(t, get.Header.Get("ETag"), head.Header.Get("ETag"))
+	assert.NotEmpty(t, head.Header.Get("Last-Modified"))
+	assert.Equal(t, get.Header.Get("Last-Modified"), head.Header.Get("Last-Modified"))
+
+	head, _ = send(t, "HEAD", server.URL+"/items/2", "")
+	assert.Equal(t, http.StatusNotFound, head.StatusCode)
+}
+
+func TestHeadCollection(t *testing.T) {
+
+	server := newTestServer(t)
+	send(t, "PUT", server.URL+"/items/1", `{"id":"1"}`)
+	send(t, "PUT", server.URL+"/items/2", `{"id":"2"}`)
+
+	get, body := send(t, "GET", server.URL+"/items", "")
+	head, headBody := send(t, "HEAD", server.URL+"/items", "")
+
+	assert.Equal(t, http.StatusOK, head.StatusCode)
+	assert.Empty(t, headBody)
+	assert.Equal(t, strconv.Itoa(len(body)), head.Header.Get("Content-Length"))
+	assert.NotEmpty(t, head.Header.Get("ETag"), "Collections should have an ETag")
+	assert.Equal(t, get.Header.Get("ETag"), head.Header.Get("ETag"))
+	assert.NotEmpty(t, head.Header.Get("Last-Modified"))
+
+	response, _ := send(t, "GET", server.URL+"/items", "", "If-None-Match", get.Header.Get("ETag"))
+	assert.Equal(t, http.StatusNotModified, response.StatusCode, "Unchanged collections should not be returned again")
+
+	send(t, "PUT", server.URL+"/items/3", `{"id":"3"}`)
+	response, _ = send(t, "GET", server.URL+"/items", "", "If-None-Match", get.Header.Get("ETag"))
+	assert.Equal(t, http.StatusOK, response.StatusCode, "Changed collections should be returned")
+}
+
+func TestHeadData(t *testing.T) {
+
+	server := newTestServer(t)
+	send(t, "PUT", server.URL+"/files/notes", "some notes", "Content-Type", "text/plain")
+
+	head, body := send(t, "HEAD", server.URL+"/files/notes", "")
+	assert.Equal(t, http.StatusOK, head.StatusCode)
+	assert.Empty(t, body)
+	assert.Equal(t, "10", head.Header.Get("Content-Length"))
+	assert.NotEmpty(t, head.Header.Get("ETag"))
+	assert.NotEmpty(t, head.Header.Get("Last-Modified"))
+}
+
+func TestOptions(t *testing.T) {
+
+	server := newTestServer(t)
+
+	response, _ := send(t, "OPTIONS", server.URL+"/items/1", "")
+	assert.Equal(t, http.StatusNoContent, response.StatusCode)
+	assert.Equal(t, "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS", response.Header.Get("Allow"))
+
+	response, _ = send(t, "OPTIONS", server.URL+collectionsPath, "")
+	assert.Equal(t, http.StatusNoContent, response.StatusCode)
+	assert.Equal(t, "GET, HEAD, OPTIONS", response.Header.Get("Allow"))
+}
+
+func TestUnsupportedMethods(t *testing.T) {
+
+	server := newTestServer(t)
+
+	for _, method := range []string{"TRACE", "CONNECT", "PROPFIND"} {
+		response, _ := send(t, method, server.URL+"/items/1", "")
+		assert.Equal(t, http.StatusMethodNotAllowed, response.StatusCode, method)
+		assert.Equal(t, "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS", response.Header.Get("Allow"), method)
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+
+	server := newTestServer(t, WithReadOnly(), WithSeed(map[string]interface{}{"items/1": map[string]interface{}{"id": "1"}}))
+
+	for _, method := range []string{"POST", "PUT", "PATCH", "DELETE"} {
+		response, _ := send(t, method, server.URL+"/items/1", `{"id":"1"}`)
+		assert.Equal(t, http.StatusMethodNotAllowed, response.StatusCode, method)
+		assert.Equal(t, "GET, HEAD, OPTIONS", response.Header.Get("Allow"), method)
+	}
+
+	response, _ := send(t, "GET", server.URL+"/items/1", "")
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+
+	response, _ = send(t, "OPTIONS", server.URL+"/items/1", "")
+	assert.Equal(t, "GET, HEAD, OPTIONS", response.Header.Get("Allow"))
+}
@@ -0,0 +1,115 @@
+package rest
+
+import (
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+)
+
+// keyLocks serializes requests that change the same documents. A document is locked by its key, a collection by its
+// key followed by a slash, which also locks all documents directly in the collection, and everything below a key by the
+// key followed by /..., which clients can not use as key as names starting with a dot are reserved.
+type keyLocks struct {
+	mutex    sync.Mutex
+	released *sync.Cond
+	held     map[string]bool
+}
+
+func newKeyLocks() *keyLocks {
+	locks := &keyLocks{held: make(map[string]bool)}
+	locks.released = sync.NewCond(&locks.mutex)
+	return locks
+}
+
+// lock waits until none of the keys are locked by other requests, locks them, and returns the function that unlocks them.
+func (locks *keyLocks) lock(keys ...string) func() {
+
+	locks.mutex.Lock()
+	defer locks.mutex.Unlock()
+
+	for locks.conflicts(keys) {
+		locks.released.Wait()
+	}
+	for _, key := range keys {
+		locks.held[key] = true
+	}
+
+	return func() {
+		locks.mutex.Lock()
+		defer locks.mutex.Unlock()
+
+		for _, key := range keys {
+			delete(locks.held, key)
+		}
+		locks.released.Broadcast()
+	}
+}
+
+// conflicts indicates if any of the keys is locked, directly or through the collection it is in.
+func (locks *keyLocks) conflicts(keys []string) bool {
+
+	for _, key := range keys {
+		for held := range locks.held {
+			if key == held || isLockedBy(key, held) || isLockedBy(held, key) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// subtreeSuffix is the suffix of the keys that lock all documents and collections below a key.
+const subtreeSuffix = "/..."
+
+// isLockedBy indicates if the key is a document in the collection that is locked by the other key,
+// or a document or collection below the key that the other key locks with everything below it.
+func isLockedBy(key string, other string) bool {
+
+	if strings.HasSuffix(other, subtreeSuffix) {
+		prefix := strings.TrimSuffix(other, subtreeSuffix)
+		return key != other && (prefix == "" || strings.HasPrefix(key, prefix+"/"))
+	}
+
+	if !strings.HasSuffix(other, "/") || strings.HasSuffix(key, "/") {
+		return false
+	}
+
+	collection := path.Dir(key)
+	if collection == "." {
+		collection = ""
+	}
+
+	return collection+"/" == other
+}
+
+// lockKeys returns the keys a request locks while it is handled, which are the documents and collections it can change.
+func lockKeys(request *http.Request) []string {
+
+	key := getURLWithSlashRemovedIfNeeded(request)
+	collection := key + "/"
+
+	switch request.Method {
+	case "POST":
+		if request.URL.Query().Get("_restore") != "" {
+			return []string{key}
+		}
+		// Batches and generated ids need the whole collection, to detect conflicts between items
+		return []string{collection}
+	case "PUT":
+		// Arrays and multipart bodies replace the collection at the key
+		return []string{key, collection}
+	case "DELETE":
+		// Without an item at the key, the items in the collection at the key are deleted, and those in the collections
+		// below it as well with depth or recursive
+		if _, nested, err := parseDepth(request.URL.Query()); err == nil && nested {
+			return []string{key, collection, key + subtreeSuffix}
+		}
+		return []string{key, collection}
+	case "PATCH":
+		return []string{key}
+	default:
+		return nil
+	}
+}
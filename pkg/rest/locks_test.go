@@ -0,0 +1,106 @@
+package rest
+
+import (
+	"fmt"
+	"github.com/akleinloog/lazy-rest/pkg/storage"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCollectionLocksDocuments(t *testing.T) {
+
+	locks := newKeyLocks()
+	unlock := locks.lock("items/")
+
+	locked := make(chan bool)
+	go func() {
+		unlockDocument := locks.lock("items/1")
+		locked <- true
+		unlockDocument()
+	}()
+
+	select {
+	case <-locked:
+		t.Fatal("A document should not be locked while its collection is")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	unlockOther := locks.lock("others/1", "items/1/")
+	unlockOther()
+
+	unlock()
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		t.Fatal("A document should be locked once its collection is unlocked")
+	}
+}
+
+func TestIsLockedBy(t *testing.T) {
+	assert.True(t, isLockedBy("items/1", "items/"))
+	assert.True(t, isLockedBy("items", "/"))
+	assert.False(t, isLockedBy("items/1/2", "items/"))
+	assert.False(t, isLockedBy("items/", "items/"))
+	assert.False(t, isLockedBy("items/1", "items"))
+
+	assert.True(t, isLockedBy("items/1/comments/a", "items/..."))
+	assert.True(t, isLockedBy("items/1/comments/", "items/..."))
+	assert.True(t, isLockedBy("items/1/...", "items/..."))
+	assert.True(t, isLockedBy("others/1", "/..."))
+	assert.False(t, isLockedBy("itemsx/1", "items/..."))
+	assert.False(t, isLockedBy("items", "items/..."))
+}
+
+func TestRecursiveDeleteLocksNestedCollections(t *testing.T) {
+
+	request, _ := http.NewRequest("DELETE", "/items?recursive=true&confirm=/items", nil)
+	keys := lockKeys(request)
+	assert.Contains(t, keys, "items/...")
+
+	locks := newKeyLocks()
+	unlock := locks.lock(keys...)
+	defer unlock()
+
+	put, _ := http.NewRequest("PUT", "/items/1/comments/a", nil)
+	assert.True(t, locks.conflicts(lockKeys(put)), "Nested documents should be locked during a recursive delete")
+
+	other, _ := http.NewRequest("PUT", "/others/1", nil)
+	assert.False(t, locks.conflicts(lockKeys(other)))
+}
+
+func TestConcurrentPatchesAreNotLost(t *testing.T) {
+
+	directory, err := ioutil.TempDir("", "lazy-rest")
+	if !assert.NoError(t, err, "Error occurred while creating test directory") {
+		return
+	}
+	defer os.RemoveAll(directory)
+
+	// Files take long enough to write for concurrent patches to overlap
+	store, err := storage.NewFileStore(directory)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	server := newTestServer(t, WithStore(store))
+	send(t, "PUT", server.URL+"/items/1", `{"id":"1"}`)
+
+	var group sync.WaitGroup
+	for index := 0; index < 20; index++ {
+		group.Add(1)
+		go func(index int) {
+			defer group.Done()
+			send(t, "PATCH", server.URL+"/items/1", fmt.Sprintf(`{"field%d":%d}`, index, index), "Content-Type", mergePatchContentType)
+		}(index)
+	}
+	group.Wait()
+
+	response, body := send(t, "GET", server.URL+"/items/1", "")
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Len(t, decodeObject(t, body), 21, "Every patch should be applied to the result of the previous one")
+}
@@ -0,0 +1,260 @@
+package rest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/akleinloog/lazy-rest/pkg/storage"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ManagedFields configures the fields that the server maintains in the JSON objects it stores.
+// Fields with an empty name are not maintained.
+type ManagedFields struct {
+	// CreatedAt is the name of the field holding when the object was first stored.
+	CreatedAt string
+	// UpdatedAt is the name of the field holding when the object was last stored, it is also sent as Last-Modified.
+	UpdatedAt string
+	// Version is the name of the field counting how often the object was stored.
+	Version string
+	// CreatedBy is the name of the field holding the user that first stored the object.
+	CreatedBy string
+	// TimestampFormat is rfc3339 (the default), rfc3339nano, unix or unixmilli, the last two are numbers.
+	TimestampFormat string
+	// UserHeader is the request header that identifies the user, by default Authorization. For Authorization, the user
+	// name of Basic authentication or the subject of a JSON Web Token is used, other headers are used as they are.
+	UserHeader string
+	// Reject makes the server reject objects in which managed fields are changed, by default the changes are ignored.
+	Reject bool
+	// HeadersOnly leaves managed fields out of responses, they are only sent as headers.
+	HeadersOnly bool
+}
+
+// The supported timestamp formats.
+const (
+	TimestampRFC3339     = "rfc3339"
+	TimestampRFC3339Nano = "rfc3339nano"
+	TimestampUnix        = "unix"
+	TimestampUnixMilli   = "unixmilli"
+)
+
+// WithManagedFields makes the server maintain fields like createdAt and updatedAt in the JSON objects it stores.
+func WithManagedFields(fields ManagedFields) Option {
+	return func(server *Server) {
+		if fields.TimestampFormat == "" {
+			fields.TimestampFormat = TimestampRFC3339
+		}
+		if fields.UserHeader == "" {
+			fields.UserHeader = "Authorization"
+		}
+		server.managed = &fields
+	}
+}
+
+// validate checks that the configuration of the managed fields can be used.
+func (fields *ManagedFields) validate() error {
+
+	switch fields.TimestampFormat {
+	case TimestampRFC3339, TimestampRFC3339Nano, TimestampUnix, TimestampUnixMilli:
+		return nil
+	default:
+		return fmt.Errorf("unknown timestamp format `%s`, use %s, %s, %s or %s", fields.TimestampFormat,
+			TimestampRFC3339, TimestampRFC3339Nano, TimestampUnix, TimestampUnixMilli)
+	}
+}
+
+// names returns the names of the fields that are maintained.
+func (fields *ManagedFields) names() []string {
+	var names []string
+	for _, name := range []string{fields.CreatedAt, fields.UpdatedAt, fields.Version, fields.CreatedBy} {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// timestamp returns a moment in the configured format.
+func (fields *ManagedFields) timestamp(moment time.Time) interface{} {
+
+	moment = moment.UTC()
+
+	switch fields.TimestampFormat {
+	case TimestampRFC3339Nano:
+		return moment.Format(time.RFC3339Nano)
+	case TimestampUnix:
+		return float64(moment.Unix())
+	case TimestampUnixMilli:
+		return float64(moment.UnixNano() / int64(time.Millisecond))
+	default:
+		return moment.Format(time.RFC3339)
+	}
+}
+
+// parseTimestamp returns the moment of a stored timestamp, and indicates if it is valid.
+func (fields *ManagedFields) parseTimestamp(value interface{}) (time.Time, bool) {
+
+	switch typed := value.(type) {
+	case string:
+		moment, err := time.Parse(time.RFC3339Nano, typed)
+		return moment, err == nil
+	case float64:
+		if fields.TimestampFormat == TimestampUnixMilli {
+			return time.Unix(0, int64(typed)*int64(time.Millisecond)), true
+		}
+		return time.Unix(int64(typed), 0), true
+	default:
+		return time.Time{}, false
+	}
+}
+
+// manageFields sets the managed fields of content that is about to replace the current document, which is nil
+// when there is none. Fields that are created once are taken from the current document, the others are updated.
+// Changes to managed fields are ignored, or rejected when configured.
+func (server *Server) manageFields(request *http.Request, content interface{}, current *storage.Document) error {
+
+	fields := server.managed
+	object, isObject := content.(map[string]interface{})
+	if fields == nil || !isObject {
+		return nil
+	}
+
+	var previous map[string]interface{}
+	if current != nil && current.IsJSON() {
+		previous, _ = current.Content.(map[string]interface{})
+	}
+
+	now := fields.timestamp(time.Now())
+	values := make(map[string]interface{})
+
+	keep := func(name string, initial interface{}) {
+		if name == "" {
+			return
+		}
+		if value, present := previous[name]; present {
+			values[name] = value
+		} else if initial != nil {
+			values[name] = initial
+		}
+	}
+
+	var user interface{}
+	if name := userFrom(request, fields.UserHeader); name != "" {
+		user = name
+	}
+
+	keep(fields.CreatedAt, now)
+	keep(fields.CreatedBy, user)
+	if fields.UpdatedAt != "" {
+		values[fields.UpdatedAt] = now
+	}
+	if fields.Version != "" {
+		version, _ := previous[fields.Version].(float64)
+		values[fields.Version] = version + 1
+	}
+
+	for _, name := range fields.names() {
+		provided, present := object[name]
+		if present && fields.Reject && !reflect.DeepEqual(provided, previous[name]) {
+			return fmt.Errorf("Field `%s` is managed by the server and can not be changed", name)
+		}
+		if value, set := values[name]; set {
+			object[name] = value
+		} else {
+			delete(object, name)
+		}
+	}
+
+	return nil
+}
+
+// present returns the content as it is returned to clients, without managed fields when they are sent as headers only.
+func (server *Server) present(content interface{}) interface{} {
+
+	object, isObject := content.(map[string]interface{})
+	if server.managed == nil || !server.managed.HeadersOnly || !isObject {
+		return content
+	}
+
+	presented := make(map[string]interface{}, len(object))
+	for name, value := range object {
+		presented[name] = value
+	}
+	for _, name := range server.managed.names() {
+		delete(presented, name)
+	}
+
+	return presented
+}
+
+// setManagedHeaders sends the managed fields of content as headers, updatedAt as Last-Modified.
+func (server *Server) setManagedHeaders(writer http.ResponseWriter, content interface{}) {
+
+	fields := server.managed
+	object, isObject := content.(map[string]interface{})
+	if fields == nil || !isObject {
+		return
+	}
+
+	header := writer.Header()
+
+	if moment, valid := fields.parseTimestamp(object[fields.UpdatedAt]); fields.UpdatedAt != "" && valid {
+		header.Set("Last-Modified", moment.UTC().Format(http.TimeFormat))
+	}
+	if moment, valid := fields.parseTimestamp(object[fields.CreatedAt]); fields.CreatedAt != "" && valid {
+		header.Set("X-Created-At", moment.UTC().Format(time.RFC3339))
+	}
+	if version, isNumber := object[fields.Version].(float64); fields.Version != "" && isNumber {
+		header.Set("X-Version", strconv.FormatFloat(version, 'f', -1, 64))
+	}
+	if user, isString := object[fields.CreatedBy].(string); fields.CreatedBy != "" && isString {
+		header.Set("X-Created-By", user)
+	}
+}
+
+// userFrom returns the user that sends a request, as identified by the header.
+func userFrom(request *http.Request, header string) string {
+
+	value := strings.TrimSpace(request.Header.Get(header))
+	if !strings.EqualFold(header, "Authorization") {
+		return value
+	}
+
+	if user, _, isBasic := request.BasicAuth(); isBasic {
+		return user
+	}
+
+	if strings.HasPrefix(value, "Bearer ") {
+		return subjectOf(strings.TrimSpace(strings.TrimPrefix(value, "Bearer ")))
+	}
+
+	// Other credentials are not stored, as they could be secret
+	return ""
+}
+
+// subjectOf returns the subject of a JSON Web Token, without verifying it, or an empty string when it has none.
+func subjectOf(token string) string {
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return ""
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return ""
+	}
+
+	var claims struct {
+		Subject string `json:"sub"`
+	}
+	if json.Unmarshal(payload, &claims) != nil {
+		return ""
+	}
+
+	return claims.Subject
+}
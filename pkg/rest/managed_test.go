@@ -0,0 +1,124 @@
+package rest
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+var allManagedFields = ManagedFields{CreatedAt: "createdAt", UpdatedAt: "updatedAt", Version: "version", CreatedBy: "createdBy"}
+
+func decodeObject(t *testing.T, body string) map[string]interface{} {
+	var object map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(body), &object), "Response should be a JSON object")
+	return object
+}
+
+func TestManagedFields(t *testing.T) {
+
+	server := newTestServer(t, WithManagedFields(allManagedFields))
+
+	request, _ := http.NewRequest("PUT", "/", nil)
+	request.SetBasicAuth("alice", "secret")
+	authorization := request.Header.Get("Authorization")
+
+	response, _ := send(t, "PUT", server.URL+"/items/1", `{"name":"First","version":42}`, "Authorization", authorization)
+	assert.Equal(t, http.StatusAccepted, response.StatusCode)
+	assert.NotEmpty(t, response.Header.Get("Last-Modified"))
+
+	response, body := send(t, "GET", server.URL+"/items/1", "")
+	created := decodeObject(t, body)
+	assert.Equal(t, 1.0, created["version"], "Version provided by the client should be ignored")
+	assert.Equal(t, "alice", created["createdBy"])
+	assert.Equal(t, "1", response.Header.Get("X-Version"))
+	assert.Equal(t, "alice", response.Header.Get("X-Created-By"))
+
+	createdAt, err := time.Parse(time.RFC3339, created["createdAt"].(string))
+	if assert.NoError(t, err, "Created at should be a RFC 3339 timestamp") {
+		assert.Equal(t, createdAt.Format(http.TimeFormat), response.Header.Get("Last-Modified"))
+	}
+
+	response, _ = send(t, "PATCH", server.URL+"/items/1", `{"name":"Changed","createdAt":"2000-01-01T00:00:00Z"}`,
+		"Content-Type", mergePatchContentType, "Authorization", "Bearer not-a-token")
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+
+	_, body = send(t, "GET", server.URL+"/items/1", "")
+	updated := decodeObject(t, body)
+	assert.Equal(t, "Changed", updated["name"])
+	assert.Equal(t, 2.0, updated["version"])
+	assert.Equal(t, created["createdAt"], updated["createdAt"], "Created at should not change")
+	assert.Equal(t, "alice", updated["createdBy"], "Created by should not change")
+}
+
+func TestRejectManagedFields(t *testing.T) {
+
+	fields := allManagedFields
+	fields.Reject = true
+	fields.TimestampFormat = TimestampUnixMilli
+	server := newTestServer(t, WithManagedFields(fields))
+
+	response, _ := send(t, "PUT", server.URL+"/items/1", `{"name":"First","createdAt":1}`)
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+
+	response, _ = send(t, "PUT", server.URL+"/items/1", `{"name":"First"}`)
+	assert.Equal(t, http.StatusAccepted, response.StatusCode)
+
+	_, body := send(t, "GET", server.URL+"/items/1", "")
+	stored := decodeObject(t, body)
+	_, isNumber := stored["updatedAt"].(float64)
+	assert.True(t, isNumber, "Timestamps should be numbers in unixmilli format")
+
+	stored["name"] = "Second"
+	unchanged, _ := json.Marshal(stored)
+	response, _ = send(t, "PUT", server.URL+"/items/1", string(unchanged))
+	assert.Equal(t, http.StatusAccepted, response.StatusCode, "Unchanged managed fields should be accepted")
+
+	_, body = send(t, "GET", server.URL+"/items/1", "")
+	assert.Equal(t, 2.0, decodeObject(t, body)["version"])
+
+	response, _ = send(t, "PATCH", server.URL+"/items/1", `[{"op":"replace","path":"/createdAt","value":1}]`,
+		"Content-Type", jsonPatchContentType)
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode, "JSON Patch should not change managed fields")
+
+	response, _ = send(t, "PATCH", server.URL+"/items/1", `[{"op":"replace","path":"/version","value":7}]`,
+		"Content-Type", jsonPatchContentType)
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode, "JSON Patch should not change managed fields")
+
+	_, body = send(t, "GET", server.URL+"/items/1", "")
+	patched := decodeObject(t, body)
+	assert.Equal(t, 2.0, patched["version"])
+	assert.Equal(t, stored["createdAt"], patched["createdAt"])
+}
+
+func TestManagedFieldsInHeadersOnly(t *testing.T) {
+
+	fields := allManagedFields
+	fields.HeadersOnly = true
+	fields.UserHeader = "X-User"
+	server := newTestServer(t, WithManagedFields(fields))
+
+	send(t, "POST", server.URL+"/items", `{"id":"1","name":"First"}`, "X-User", "bob")
+
+	response, body := send(t, "GET", server.URL+"/items/1", "")
+	assert.JSONEq(t, `{"id":"1","name":"First"}`, body)
+	assert.Equal(t, "bob", response.Header.Get("X-Created-By"))
+	assert.NotEmpty(t, response.Header.Get("Last-Modified"))
+
+	_, body = send(t, "GET", server.URL+"/items?createdBy=bob", "")
+	assert.JSONEq(t, `[{"id":"1","name":"First"}]`, body, "Managed fields should be available to filters")
+}
+
+func TestInvalidTimestampFormat(t *testing.T) {
+
+	_, err := New(WithManagedFields(ManagedFields{UpdatedAt: "updatedAt", TimestampFormat: "iso"}), WithLogger(&quietLog))
+	assert.Error(t, err, "Unknown timestamp formats should not be accepted")
+}
+
+func TestSubjectOfToken(t *testing.T) {
+
+	token := "eyJhbGciOiJIUzI1NiJ9.eyJzdWIiOiJjYXJvbCJ9.signature"
+	assert.Equal(t, "carol", subjectOf(token))
+	assert.Equal(t, "", subjectOf("opaque"))
+}
@@ -0,0 +1,66 @@
+package rest
+
+import (
+	"fmt"
+	"github.com/akleinloog/lazy-rest/pkg/format"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// responseFormat returns the format to respond in, which is selected with the format query parameter,
+// or negotiated with the Accept header.
+func responseFormat(request *http.Request) (*format.Format, error) {
+
+	if name := request.URL.Query().Get("format"); name != "" {
+		if selected := format.ByName(name); selected != nil {
+			return selected, nil
+		}
+		return nil, fmt.Errorf("Unknown format `%s`, supported formats are %s", name, strings.Join(format.Names(), ", "))
+	}
+
+	if negotiated := format.Negotiate(request.Header.Get("Accept")); negotiated != nil {
+		return negotiated, nil
+	}
+
+	mediaTypes := make([]string, 0, len(format.All))
+	for _, supported := range format.All {
+		if supported != format.PrettyJSON {
+			mediaTypes = append(mediaTypes, supported.MediaType)
+		}
+	}
+	return nil, fmt.Errorf("None of the accepted media types is supported, use one of %s", strings.Join(mediaTypes, ", "))
+}
+
+// requestMediaType returns the media type of the request body with its parameters, which is empty without Content-Type.
+func requestMediaType(request *http.Request) (string, map[string]string, error) {
+
+	contentType := request.Header.Get("Content-Type")
+	if contentType == "" {
+		return "", nil, nil
+	}
+
+	return mime.ParseMediaType(contentType)
+}
+
+// requestFormat returns the format of a request body with the media type, or nil when the body is stored as data.
+func requestFormat(mediaType string, body []byte) *format.Format {
+
+	if isJSONContent(mediaType, body) {
+		return format.JSON
+	}
+
+	return format.ForMediaType(mediaType)
+}
+
+// decodeBody decodes a request body in a format, errors describe what is wrong for the client.
+func (server *Server) decodeBody(bodyFormat *format.Format, body []byte) (interface{}, error) {
+
+	content, err := bodyFormat.Decode(body)
+	if err != nil {
+		server.log.Error(err, "Invalid "+strings.ToUpper(bodyFormat.Name)+" received")
+		return nil, fmt.Errorf("Invalid %s: %v", strings.ToUpper(bodyFormat.Name), err)
+	}
+
+	return content, nil
+}
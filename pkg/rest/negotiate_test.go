@@ -0,0 +1,82 @@
+package rest
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+func TestRespondInNegotiatedFormat(t *testing.T) {
+
+	server := newTestServer(t, WithSeed(map[string]interface{}{
+		"items/1": map[string]interface{}{"id": "1", "name": "First", "owner": map[string]interface{}{"name": "Alice"}},
+		"items/2": map[string]interface{}{"id": "2", "name": "Second"},
+	}))
+
+	response, body := send(t, "GET", server.URL+"/items/1", "")
+	assert.Equal(t, "application/json", response.Header.Get("Content-Type"))
+	assert.JSONEq(t, `{"id":"1","name":"First","owner":{"name":"Alice"}}`, body)
+
+	response, body = send(t, "GET", server.URL+"/items/2", "", "Accept", "application/yaml")
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "application/yaml", response.Header.Get("Content-Type"))
+	assert.Equal(t, "id: \"2\"\nname: Second\n", body)
+
+	response, body = send(t, "GET", server.URL+"/items?format=csv", "", "Accept", "application/xml")
+	assert.Equal(t, "text/csv; charset=utf-8", response.Header.Get("Content-Type"))
+	assert.Equal(t, "id,name,owner.name\n1,First,Alice\n2,Second,\n", body)
+
+	response, body = send(t, "GET", server.URL+"/items", "", "Accept", "application/x-ndjson")
+	assert.Equal(t, "{\"id\":\"1\",\"name\":\"First\",\"owner\":{\"name\":\"Alice\"}}\n{\"id\":\"2\",\"name\":\"Second\"}\n", body)
+
+	response, body = send(t, "GET", server.URL+"/items/2?format=pretty", "")
+	assert.Equal(t, "{\n  \"id\": \"2\",\n  \"name\": \"Second\"\n}\n", body)
+
+	response, _ = send(t, "GET", server.URL+"/items/2", "", "Accept", "text/html")
+	assert.Equal(t, http.StatusNotAcceptable, response.StatusCode)
+
+	response, _ = send(t, "GET", server.URL+"/items/2?format=html", "")
+	assert.Equal(t, http.StatusNotAcceptable, response.StatusCode)
+
+	response, _ = send(t, "PATCH", server.URL+"/items/2", `{"name":"Changed"}`,
+		"Content-Type", mergePatchContentType, "Accept", "text/html")
+	assert.Equal(t, http.StatusNotAcceptable, response.StatusCode)
+
+	_, body = send(t, "GET", server.URL+"/items/2", "")
+	assert.JSONEq(t, `{"id":"2","name":"Second"}`, body, "Document should not be patched when the response is not acceptable")
+}
+
+func TestReadBodyInFormat(t *testing.T) {
+
+	server := newTestServer(t)
+
+	response, _ := send(t, "PUT", server.URL+"/items/1", "name: First\nprice: 10\n", "Content-Type", "application/yaml")
+	assert.Equal(t, http.StatusAccepted, response.StatusCode)
+
+	_, body := send(t, "GET", server.URL+"/items/1", "")
+	assert.JSONEq(t, `{"id":"1","name":"First","price":10}`, body)
+
+	response, _ = send(t, "PUT", server.URL+"/items/2", `<item><name>Second</name></item>`, "Content-Type", "application/xml")
+	assert.Equal(t, http.StatusAccepted, response.StatusCode)
+
+	_, body = send(t, "GET", server.URL+"/items/2", "")
+	assert.JSONEq(t, `{"id":"2","name":"Second"}`, body)
+
+	response, _ = send(t, "POST", server.URL+"/items", "id,name,owner.name\n3,Third,Alice\n4,Fourth,Bob\n", "Content-Type", "text/csv")
+	assert.Equal(t, http.StatusCreated, response.StatusCode)
+
+	_, body = send(t, "GET", server.URL+"/items/4", "")
+	assert.JSONEq(t, `{"id":"4","name":"Fourth","owner":{"name":"Bob"}}`, body)
+
+	response, _ = send(t, "POST", server.URL+"/items", "{\"id\":\"5\"}\n{\"id\":\"6\"}\n", "Content-Type", "application/x-ndjson")
+	assert.Equal(t, http.StatusCreated, response.StatusCode)
+
+	response, _ = send(t, "GET", server.URL+"/items/6", "")
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+
+	response, _ = send(t, "PUT", server.URL+"/items/7", "name: [unclosed", "Content-Type", "application/yaml")
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+
+	response, _ = send(t, "PUT", server.URL+"/items/7", `{"name":"Seventh"}`, "Content-Type", "application/json; charset")
+	assert.Equal(t, http.StatusUnsupportedMediaType, response.StatusCode)
+}
@@ -0,0 +1,162 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+	"github.com/akleinloog/lazy-rest/pkg/storage"
+	"math"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+)
+
+// collectionsPath is the path of the endpoint that lists all collections, with the number of items in them.
+const collectionsPath = "/_collections"
+
+// parseDepth parses the depth and recursive query parameters, which ask for the collections below a collection to be
+// listed as well, and indicates if they did. Recursive listings have no maximum depth.
+func parseDepth(query url.Values) (int, bool, error) {
+
+	recursive := false
+	if value := query.Get("recursive"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return 0, false, fmt.Errorf("Invalid value `%s` for recursive, expected true or false", value)
+		}
+		recursive = parsed
+	}
+
+	value := query.Get("depth")
+	if value == "" {
+		return math.MaxInt32, recursive, nil
+	}
+	if recursive {
+		return 0, false, fmt.Errorf("Depth and recursive cannot be combined")
+	}
+
+	depth, err := strconv.Atoi(value)
+	if err != nil || depth < 0 {
+		return 0, false, fmt.Errorf("Invalid depth `%s`, expected a positive number", value)
+	}
+
+	return depth, true, nil
+}
+
+// walkCollections visits the collection at the key and the collections below it up to the depth, parents first and
+// in order of their names. Reserved collections are not visited.
+func (server *Server) walkCollections(ctx context.Context, key string, depth int, visit func(key string, documents []*storage.Document)) error {
+
+	documents, err := server.store.List(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	visit(key, documents)
+
+	if depth == 0 {
+		return nil
+	}
+
+	names, err := server.store.Collections(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		err = server.walkCollections(ctx, path.Join(key, name), depth-1, visit)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// hasCollections indicates if there are collections below the key, which makes it a collection even without items.
+func (server *Server) hasCollections(ctx context.Context, key string) (bool, error) {
+
+	names, err := server.store.Collections(ctx, key)
+	if err != nil {
+		return false, err
+	}
+
+	return len(names) > 0, nil
+}
+
+// respondWithNested responds with the items in the collection at the key and in the collections below it, up to the
+// depth. The items in every collection are filtered and sorted as requested. By default the collections are returned
+// as a tree, with flat=true as a map of the paths of the items to the items.
+func (server *Server) respondWithNested(writer http.ResponseWriter, request *http.Request, key string, depth int, filters []filterCondition, sortFields []sortField) {
+
+	flat := false
+	if value := request.URL.Query().Get("flat"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			http.Error(writer, fmt.Sprintf("Invalid value `%s` for flat, expected true or false", value), http.StatusBadRequest)
+			return
+		}
+		flat = parsed
+	}
+
+	items := make(map[string]interface{})
+	trees := make(map[string]map[string]interface{})
+
+	err := server.walkCollections(request.Context(), key, depth, func(collection string, documents []*storage.Document) {
+
+		collectionItems := filterItems(toCollectionItems(documents, server.idField), filters)
+		sortItems(collectionItems, sortFields)
+
+		contentItems := make([]interface{}, 0, len(collectionItems))
+		for _, item := range collectionItems {
+			content := server.present(item.content)
+			contentItems = append(contentItems, content)
+			items["/"+path.Join(collection, item.key)] = content
+		}
+
+		tree := map[string]interface{}{"items": contentItems}
+		trees[collection] = tree
+
+		if collection != key {
+			parentKey := path.Dir(collection)
+			if parentKey == "." {
+				parentKey = ""
+			}
+			parent := trees[parentKey]
+			if _, present := parent["collections"]; !present {
+				parent["collections"] = make(map[string]interface{})
+			}
+			parent["collections"].(map[string]interface{})[path.Base(collection)] = tree
+		}
+	})
+	if err != nil {
+		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if flat {
+		server.respondWithCollection(writer, request, items)
+		return
+	}
+	server.respondWithCollection(writer, request, trees[key])
+}
+
+// handleCollections lists every collection that holds items, directly or in collections below it,
+// with its path and the number of items directly in it.
+func (server *Server) handleCollections(writer http.ResponseWriter, request *http.Request) {
+
+	collections := make([]interface{}, 0)
+
+	err := server.walkCollections(request.Context(), "", math.MaxInt32, func(collection string, documents []*storage.Document) {
+		if collection == "" && len(documents) == 0 {
+			return
+		}
+		collections = append(collections, map[string]interface{}{"path": "/" + collection, "count": len(documents)})
+	})
+	if err != nil {
+		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	server.respondWithCollection(writer, request, collections)
+}
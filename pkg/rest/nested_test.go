@@ -0,0 +1,106 @@
+package rest
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newNestedTestServer(t *testing.T) *httptest.Server {
+	return newTestServer(t, WithSeed(map[string]interface{}{
+		"api/items/1":                  map[string]interface{}{"id": "1", "kind": "a"},
+		"api/items/2":                  map[string]interface{}{"id": "2", "kind": "b"},
+		"api/items/1/comments/c":       map[string]interface{}{"id": "c", "kind": "a"},
+		"api/users/u/roles/admin":      map[string]interface{}{"id": "admin"},
+		"api/users/u/roles/admin/more": map[string]interface{}{"id": "more"},
+	}))
+}
+
+func TestCollectionsWithOnlyCollectionsExist(t *testing.T) {
+
+	server := newNestedTestServer(t)
+
+	response, body := send(t, "GET", server.URL+"/api", "")
+	assert.Equal(t, http.StatusOK, response.StatusCode, "Collections that only hold other collections should be found")
+	assert.JSONEq(t, `[]`, body)
+
+	response, _ = send(t, "GET", server.URL+"/missing", "")
+	assert.Equal(t, http.StatusNotFound, response.StatusCode)
+}
+
+func TestNestedListingAsTree(t *testing.T) {
+
+	server := newNestedTestServer(t)
+
+	response, body := send(t, "GET", server.URL+"/api?depth=2", "")
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.JSONEq(t, `{
+		"items": [],
+		"collections": {
+			"items": {
+				"items": [{"id":"1","kind":"a"},{"id":"2","kind":"b"}],
+				"collections": {"1": {"items": []}}
+			},
+			"users": {"items": [], "collections": {"u": {"items": []}}}
+		}
+	}`, body, "Collections should be listed up to the depth")
+
+	response, body = send(t, "GET", server.URL+"/api/items?depth=0", "")
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.JSONEq(t, `{"items": [{"id":"1","kind":"a"},{"id":"2","kind":"b"}]}`, body)
+}
+
+func TestRecursiveListingAsMap(t *testing.T) {
+
+	server := newNestedTestServer(t)
+
+	response, body := send(t, "GET", server.URL+"/api?recursive=true&flat=true", "")
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.JSONEq(t, `{
+		"/api/items/1": {"id":"1","kind":"a"},
+		"/api/items/2": {"id":"2","kind":"b"},
+		"/api/items/1/comments/c": {"id":"c","kind":"a"},
+		"/api/users/u/roles/admin": {"id":"admin"},
+		"/api/users/u/roles/admin/more": {"id":"more"}
+	}`, body)
+
+	response, body = send(t, "GET", server.URL+"/api?recursive=true&flat=true&kind=a", "")
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.JSONEq(t, `{"/api/items/1": {"id":"1","kind":"a"}, "/api/items/1/comments/c": {"id":"c","kind":"a"}}`, body,
+		"Filters should apply to the items in every collection")
+}
+
+func TestInvalidNestedListings(t *testing.T) {
+
+	server := newNestedTestServer(t)
+
+	for _, query := range []string{"depth=-1", "depth=x", "recursive=maybe", "depth=1&recursive=true", "depth=1&limit=1", "recursive=true&flat=x"} {
+		response, _ := send(t, "GET", server.URL+"/api?"+query, "")
+		assert.Equal(t, http.StatusBadRequest, response.StatusCode, query)
+	}
+}
+
+func TestCollectionsEndpoint(t *testing.T) {
+
+	server := newNestedTestServer(t)
+	send(t, "PUT", server.URL+"/top", `{"id":"top"}`)
+
+	response, body := send(t, "GET", server.URL+"/_collections", "")
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.JSONEq(t, `[
+		{"path": "/", "count": 1},
+		{"path": "/api", "count": 0},
+		{"path": "/api/items", "count": 2},
+		{"path": "/api/items/1", "count": 0},
+		{"path": "/api/items/1/comments", "count": 1},
+		{"path": "/api/users", "count": 0},
+		{"path": "/api/users/u", "count": 0},
+		{"path": "/api/users/u/roles", "count": 1},
+		{"path": "/api/users/u/roles/admin", "count": 1}
+	]`, body)
+
+	response, _ = send(t, "DELETE", server.URL+"/_collections", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, response.StatusCode)
+	assert.Equal(t, "GET, HEAD, OPTIONS", response.Header.Get("Allow"))
+}
@@ -0,0 +1,135 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/akleinloog/lazy-rest/pkg/patch"
+	"github.com/akleinloog/lazy-rest/pkg/storage"
+	"io/ioutil"
+	"mime"
+	"net/http"
+)
+
+const (
+	mergePatchContentType = "application/merge-patch+json"
+	jsonPatchContentType  = "application/json-patch+json"
+)
+
+func (server *Server) handlePATCH(writer http.ResponseWriter, request *http.Request) {
+
+	key := getURLWithSlashRemovedIfNeeded(request)
+	if key == "" {
+		http.Error(writer, errRootDocument.Error(), http.StatusBadRequest)
+		return
+	}
+
+	body, err := ioutil.ReadAll(request.Body)
+	if err != nil {
+		server.log.Error(err, "Unable to read request body")
+		http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	contentType, _, err := mime.ParseMediaType(request.Header.Get("Content-Type"))
+	if err != nil || (contentType != mergePatchContentType && contentType != jsonPatchContentType) {
+		writer.Header().Set("Accept-Patch", mergePatchContentType+", "+jsonPatchContentType)
+		http.Error(writer, http.StatusText(http.StatusUnsupportedMediaType), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	_, err = responseFormat(request)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusNotAcceptable)
+		return
+	}
+
+	current, exists, err := server.store.Get(request.Context(), key)
+	if err != nil {
+		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if status := checkPreconditions(request, currentVersion(current), exists); status != 0 {
+		respondToFailedPrecondition(writer, status, currentVersion(current))
+		return
+	}
+
+	if !exists {
+		http.Error(writer, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	if !current.IsJSON() {
+		http.Error(writer, "Only JSON documents can be patched", http.StatusConflict)
+		return
+	}
+
+	// Patch a copy, as the current document is needed to maintain managed fields
+	var content interface{}
+	err = storage.Convert(current.Content, &content)
+	if err != nil {
+		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if contentType == mergePatchContentType {
+		var mergePatch interface{}
+		err = json.Unmarshal(body, &mergePatch)
+		if err != nil {
+			server.log.Error(err, "Invalid JSON received")
+			http.Error(writer, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		content = patch.MergePatch(content, mergePatch)
+	} else {
+		operations, err := patch.DecodeOperations(body)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+		content, err = patch.Apply(content, operations)
+		if err != nil {
+			http.Error(writer, err.Error(), patchErrorStatus(err))
+			return
+		}
+	}
+
+	err = server.prepareDocument(content, key)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = server.manageFields(request, content, current)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if server.rejectsContent(writer, key, content) {
+		return
+	}
+
+	document, err := server.store.Put(request.Context(), key, content)
+	if err != nil {
+		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	server.setManagedHeaders(writer, content)
+	setEntityTag(writer, document.Version)
+	server.respondWithContent(writer, request, server.present(content))
+}
+
+// patchErrorStatus determines the status code to respond with when applying a JSON Patch failed.
+func patchErrorStatus(err error) int {
+
+	switch {
+	case errors.Is(err, patch.ErrTestFailed):
+		return http.StatusConflict
+	case errors.Is(err, patch.ErrInvalidPatch):
+		return http.StatusBadRequest
+	default:
+		return http.StatusUnprocessableEntity
+	}
+}
@@ -7,23 +7,73 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/akleinloog/lazy-rest/app"
-	"github.com/akleinloog/lazy-rest/pkg/storage"
+	"github.com/akleinloog/lazy-rest/pkg/format"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"path"
 )
 
-func handlePOST(writer http.ResponseWriter, request *http.Request) {
+func (server *Server) handlePOST(writer http.ResponseWriter, request *http.Request) {
 
-	key := getURLWithSlashAddedIfNeeded(request)
+	if number := request.URL.Query().Get("_restore"); number != "" {
+		server.restoreRevision(writer, request, getURLWithSlashRemovedIfNeeded(request), number)
+		return
+	}
+
+	key := getURLWithSlashRemovedIfNeeded(request)
 
 	body, err := ioutil.ReadAll(request.Body)
 	if err != nil {
-		app.Log.Error(err, "Invalid Request Body received")
+		server.log.Error(err, "Invalid Request Body received")
 		http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 		return
 	}
 
+	mediaType, params, err := requestMediaType(request)
+	if err != nil {
+		http.Error(writer, http.StatusText(http.StatusUnsupportedMediaType), http.StatusUnsupportedMediaType)
+		return
+	}
+	if mediaType == multipartContentType {
+		server.storeParts(writer, request, key, body, params["boundary"], http.StatusCreated)
+		return
+	}
+
+	bodyFormat := requestFormat(mediaType, body)
+	if bodyFormat == nil {
+		id, err := server.ids.generate(request.Context(), key, nil)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+		server.postData(writer, request, path.Join(key, id), body)
+		return
+	}
+
+	if bodyFormat != format.JSON {
+		// Items in other formats are converted to JSON, so they are read in the same way
+		content, err := server.decodeBody(bodyFormat, body)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+		body, err = json.Marshal(content)
+		if err != nil {
+			http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	preferences := preferencesOf(request)
+	if preferences["return"] != returnMinimal {
+		_, err = responseFormat(request)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusNotAcceptable)
+			return
+		}
+	}
+
 	request.Body = ioutil.NopCloser(bytes.NewBuffer(body))
 
 	// Remove whitespace
@@ -39,13 +89,14 @@ func handlePOST(writer http.ResponseWriter, request *http.Request) {
 		// then the decoder will iterate over the items in the array
 		_, err = decoder.Token()
 		if err != nil {
-			app.Log.Error(err, "Error parsing JSON token")
+			server.log.Error(err, "Error parsing JSON token")
 			http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 			return
 		}
 	}
 
-	var itemsInRequest = make(map[string]interface{})
+	var itemsInRequest []postedItem
+	names := make(map[string]bool)
 
 	for decoder.More() {
 
@@ -55,33 +106,195 @@ func handlePOST(writer http.ResponseWriter, request *http.Request) {
 
 		if err != nil {
 
-			app.Log.Error(err, "Invalid JSON received")
+			server.log.Error(err, "Invalid JSON received")
 			http.Error(writer, "Invalid JSON", http.StatusBadRequest)
 			return
 
 		} else {
 
-			id, prs := content["id"]
+			id, prs := content[server.idField]
 			if !prs {
-				id = createId()
-				content["id"] = id
+				id, err = server.ids.generate(request.Context(), key, content)
+				if err != nil {
+					http.Error(writer, err.Error(), http.StatusBadRequest)
+					return
+				}
+				content[server.idField] = id
 			}
 
-			contentKey := fmt.Sprintf("%s%s", key, id)
-			itemsInRequest[contentKey] = content
+			name := idName(id)
+			if err := checkId(name); err != nil {
+				http.Error(writer, fmt.Sprintf("Item %d has invalid id `%s`, %s", len(itemsInRequest), name, err.Error()), http.StatusBadRequest)
+				return
+			}
+			if names[name] {
+				http.Error(writer, fmt.Sprintf("Item %d has duplicate id `%s`", len(itemsInRequest), name), http.StatusBadRequest)
+				return
+			}
+			names[name] = true
+
+			itemsInRequest = append(itemsInRequest, postedItem{key: path.Join(key, name), content: content})
+		}
+	}
+
+	upsert := server.upserts(writer, preferences)
+
+	var violations []schemaViolation
+
+	for index, item := range itemsInRequest {
+		current, exists, err := server.store.Get(request.Context(), item.key)
+		if err != nil {
+			http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		if exists && !upsert {
+			http.Error(writer, fmt.Sprintf("Item with id `%s` already exists", path.Base(item.key)), http.StatusConflict)
+			return
+		}
+		err = server.manageFields(request, item.content, current)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+		itemsInRequest[index].existed = exists
+
+		pointer := ""
+		if isArray {
+			pointer = fmt.Sprintf("/%d", index)
 		}
+		violations = append(violations, server.schemas.check(item.key, item.content, pointer)...)
+	}
+
+	if len(violations) > 0 {
+		server.respondWithViolations(writer, violations)
+		return
 	}
 
-	for key, element := range itemsInRequest {
-		err := storage.Store(key, element)
+	for index, item := range itemsInRequest {
+		document, err := server.store.Put(request.Context(), item.key, item.content)
 		if err != nil {
 			http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 			return
 		}
+		itemsInRequest[index].version = document.Version
+	}
+
+	if !isArray && len(itemsInRequest) == 1 {
+		server.respondWithPosted(writer, request, itemsInRequest[0], preferences["return"])
+		return
+	}
+
+	summary := postSummary{Created: []string{}, Updated: []string{}}
+	for _, item := range itemsInRequest {
+		if item.existed {
+			summary.Updated = append(summary.Updated, locationOf(item.key))
+		} else {
+			summary.Created = append(summary.Created, locationOf(item.key))
+		}
+	}
+
+	status := http.StatusOK
+	if len(summary.Created) > 0 {
+		status = http.StatusCreated
+	}
+
+	server.respondWithPreference(writer, request, status, preferences["return"], summary)
+}
+
+// upserts indicates if posted items replace items that already exist, instead of being rejected, which is the case
+// with upsert enabled or when the client prefers to merge duplicates.
+func (server *Server) upserts(writer http.ResponseWriter, preferences map[string]string) bool {
+
+	upsert := server.upsert || preferences["resolution"] == resolutionMergeDuplicates
+	if upsert && !server.upsert {
+		writer.Header().Add("Preference-Applied", "resolution="+resolutionMergeDuplicates)
+	}
+
+	return upsert
+}
+
+// postedItem is an object that is posted to a collection, with the key it is stored under.
+type postedItem struct {
+	key     string
+	content map[string]interface{}
+	existed bool
+	version string
+}
+
+// postSummary lists the locations of the items that are created or updated by posting more than one item.
+type postSummary struct {
+	Created []string `json:"created"`
+	Updated []string `json:"updated"`
+}
+
+// respondWithPosted responds with a single item that was posted, which is 201 Created unless it already existed.
+func (server *Server) respondWithPosted(writer http.ResponseWriter, request *http.Request, item postedItem, preference string) {
+
+	status := http.StatusCreated
+	if item.existed {
+		status = http.StatusOK
+	}
+
+	server.setManagedHeaders(writer, item.content)
+	setEntityTag(writer, item.version)
+	writer.Header().Set("Location", locationOf(item.key))
+
+	server.respondWithPreference(writer, request, status, preference, server.present(item.content))
+}
+
+// respondWithPreference responds with the content, or without a body when the client prefers a minimal response.
+func (server *Server) respondWithPreference(writer http.ResponseWriter, request *http.Request, status int, preference string, content interface{}) {
+
+	if preference == returnMinimal || preference == returnRepresentation {
+		writer.Header().Add("Preference-Applied", "return="+preference)
+	}
+
+	if preference == returnMinimal {
+		writer.WriteHeader(status)
+		return
+	}
+
+	responseFormat, err := responseFormat(request)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusNotAcceptable)
+		return
+	}
+
+	writer.Header().Add("Vary", "Accept")
+	writer.Header().Set("Content-Type", responseFormat.ContentType)
+	writer.WriteHeader(status)
+
+	err = responseFormat.Encode(writer, content)
+	if err != nil {
+		server.log.Error(err, "Error while responding to request")
+	}
+}
+
+// postData stores a body that is not JSON at the key, which is returned in the Location header.
+func (server *Server) postData(writer http.ResponseWriter, request *http.Request, key string, body []byte) {
+
+	preference := preferencesOf(request)["return"]
+	if preference != returnMinimal {
+		_, err := responseFormat(request)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusNotAcceptable)
+			return
+		}
+	}
+
+	if server.rejectsData(writer, key) {
+		return
+	}
+
+	document, err := server.store.PutData(request.Context(), key, body, dataMetadata(request.Header))
+	if err != nil {
+		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
 	}
 
-	writer.WriteHeader(http.StatusCreated)
-	respond(writer, fmt.Sprintf("Created %d items", len(itemsInRequest)))
+	setEntityTag(writer, document.Version)
+	writer.Header().Set("Location", locationOf(key))
+	server.respondWithPreference(writer, request, http.StatusCreated, preference, dataDescription(document, server.idField))
 }
 
 func createId() string {
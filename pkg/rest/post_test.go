@@ -0,0 +1,126 @@
+package rest
+
+import (
+	"encoding/json"
+	"github.com/akleinloog/lazy-rest/pkg/storage"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestPostReturnsTheCreatedItem(t *testing.T) {
+
+	server := newTestServer(t)
+
+	response, body := send(t, "POST", server.URL+"/items", `{"id":"1","name":"First"}`)
+	assert.Equal(t, http.StatusCreated, response.StatusCode)
+	assert.Equal(t, "/items/1", response.Header.Get("Location"))
+	assert.NotEmpty(t, response.Header.Get("ETag"))
+	assert.JSONEq(t, `{"id":"1","name":"First"}`, body)
+
+	response, body = send(t, "POST", server.URL+"/items", `{"name":"Second"}`, "Prefer", "return=minimal")
+	assert.Equal(t, http.StatusCreated, response.StatusCode)
+	assert.Equal(t, "return=minimal", response.Header.Get("Preference-Applied"))
+	assert.Empty(t, body, "A minimal response should not have a body")
+
+	response, _ = send(t, "GET", server.URL+response.Header.Get("Location"), "")
+	assert.Equal(t, http.StatusOK, response.StatusCode, "The Location should point at the created item")
+}
+
+func TestPostDoesNotOverwriteExistingItems(t *testing.T) {
+
+	server := newTestServer(t)
+
+	send(t, "POST", server.URL+"/items", `{"id":"1","name":"First"}`)
+
+	response, _ := send(t, "POST", server.URL+"/items", `{"id":"1","name":"Overwritten"}`)
+	assert.Equal(t, http.StatusConflict, response.StatusCode)
+
+	response, _ = send(t, "POST", server.URL+"/items", `[{"id":"2","name":"Second"},{"id":"1","name":"Overwritten"}]`)
+	assert.Equal(t, http.StatusConflict, response.StatusCode)
+
+	response, _ = send(t, "GET", server.URL+"/items/2", "")
+	assert.Equal(t, http.StatusNotFound, response.StatusCode, "Nothing should be stored when an item conflicts")
+	_, body := send(t, "GET", server.URL+"/items/1", "")
+	assert.JSONEq(t, `{"id":"1","name":"First"}`, body)
+
+	response, _ = send(t, "POST", server.URL+"/items", `[{"id":"3"},{"id":"3"}]`)
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode, "Duplicate ids should be rejected")
+}
+
+func TestPostUpserts(t *testing.T) {
+
+	server := newTestServer(t)
+
+	send(t, "POST", server.URL+"/items", `{"id":"1","name":"First"}`)
+
+	response, body := send(t, "POST", server.URL+"/items", `{"id":"1","name":"Replaced"}`, "Prefer", "resolution=merge-duplicates")
+	assert.Equal(t, http.StatusOK, response.StatusCode, "Replacing an item should not be reported as created")
+	assert.Equal(t, "resolution=merge-duplicates", response.Header.Get("Preference-Applied"))
+	assert.JSONEq(t, `{"id":"1","name":"Replaced"}`, body)
+
+	upserting := newTestServer(t, WithUpsert())
+
+	send(t, "POST", upserting.URL+"/items", `{"id":"1","name":"First"}`)
+	response, body = send(t, "POST", upserting.URL+"/items", `[{"id":"1","name":"Replaced"},{"id":"2","name":"Second"}]`)
+	assert.Equal(t, http.StatusCreated, response.StatusCode)
+	assert.JSONEq(t, `{"created":["/items/2"],"updated":["/items/1"]}`, body)
+}
+
+func TestPostBatchSummary(t *testing.T) {
+
+	server := newTestServer(t, WithIDStrategy(IDSequence))
+
+	response, body := send(t, "POST", server.URL+"/items", `[{"name":"First"},{"name":"Second"},{"name":"Third"}]`)
+	assert.Equal(t, http.StatusCreated, response.StatusCode)
+	assert.Empty(t, response.Header.Get("Location"), "A batch does not have a single location")
+
+	var summary postSummary
+	if assert.NoError(t, json.Unmarshal([]byte(body), &summary)) {
+		assert.Equal(t, []string{"/items/1", "/items/2", "/items/3"}, summary.Created, "Created items should be listed in order")
+		assert.Empty(t, summary.Updated)
+	}
+}
+
+func TestPostToRootCollection(t *testing.T) {
+
+	directory, err := ioutil.TempDir("", "lazy-rest")
+	if !assert.NoError(t, err, "Error occurred while creating test directory") {
+		return
+	}
+	defer os.RemoveAll(directory)
+
+	store, err := storage.NewFileStore(directory)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for _, server := range []*httptest.Server{newTestServer(t), newTestServer(t, WithStore(store), WithIDStrategy(IDSequence))} {
+
+		response, _ := send(t, "POST", server.URL+"/", `{"id":"a","name":"First"}`)
+		assert.Equal(t, http.StatusCreated, response.StatusCode)
+		assert.Equal(t, "/a", response.Header.Get("Location"))
+
+		response, _ = send(t, "POST", server.URL+"/", `{"name":"Second"}`)
+		assert.Equal(t, http.StatusCreated, response.StatusCode)
+		location := response.Header.Get("Location")
+
+		response, _ = send(t, "GET", server.URL+location, "")
+		assert.Equal(t, http.StatusOK, response.StatusCode, "The Location should point at the created item")
+
+		_, body := send(t, "GET", server.URL+"/", "")
+		assert.Len(t, decodeArray(t, body), 2, "Items posted to the root should be listed")
+	}
+}
+
+func TestPreferences(t *testing.T) {
+
+	request, _ := http.NewRequest("POST", "/items", nil)
+	request.Header.Add("Prefer", `return=minimal; foo="bar", respond-async`)
+	request.Header.Add("Prefer", `Resolution="merge-duplicates", return=representation`)
+
+	assert.Equal(t, map[string]string{"return": "minimal", "respond-async": "", "resolution": "merge-duplicates"}, preferencesOf(request))
+}
@@ -1,62 +1,247 @@
 package rest
 
 import (
-	"encoding/json"
 	"fmt"
-	"github.com/akleinloog/lazy-rest/app"
 	"github.com/akleinloog/lazy-rest/pkg/storage"
 	"io/ioutil"
 	"net/http"
 	"path"
+	"strconv"
+	"strings"
 )
 
-func handlePUT(writer http.ResponseWriter, request *http.Request) {
+func (server *Server) handlePUT(writer http.ResponseWriter, request *http.Request) {
 
 	key := getURLWithSlashRemovedIfNeeded(request)
 
 	body, err := ioutil.ReadAll(request.Body)
 	if err != nil {
-		app.Log.Error(err, "Unable to read request body")
+		server.log.Error(err, "Unable to read request body")
 		writer.WriteHeader(http.StatusBadRequest)
-		respond(writer, "")
+		server.respond(writer, "")
 		return
 	}
 
-	// TODO: Check Content Type / Support multiple content types
-	// memory[key] = body
-	// contentType := request.Header.Retrieve("content-type")
+	mediaType, params, err := requestMediaType(request)
+	if err != nil {
+		http.Error(writer, http.StatusText(http.StatusUnsupportedMediaType), http.StatusUnsupportedMediaType)
+		return
+	}
+	if mediaType == multipartContentType {
+		server.storeParts(writer, request, key, body, params["boundary"], http.StatusAccepted)
+		return
+	}
 
-	var content interface{}
-	err = json.Unmarshal(body, &content)
+	bodyFormat := requestFormat(mediaType, body)
+	if bodyFormat == nil {
+		if key == "" {
+			http.Error(writer, errRootDocument.Error(), http.StatusBadRequest)
+			return
+		}
+		server.putData(writer, request, key, body)
+		return
+	}
+
+	content, err := server.decodeBody(bodyFormat, body)
 	if err != nil {
-		// Invalid JSON
-		app.Log.Error(err, "Invalid JSON received")
-		http.Error(writer, "Invalid JSON", http.StatusBadRequest)
+		http.Error(writer, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	jsonContent := content.(map[string]interface{})
+	if items, isArray := content.([]interface{}); isArray {
+		isCollection, err := server.isCollectionRequest(request, key)
+		if err != nil {
+			http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		if isCollection {
+			server.replaceCollection(writer, request, key, items)
+			return
+		}
+	}
+
+	if key == "" {
+		http.Error(writer, errRootDocument.Error(), http.StatusBadRequest)
+		return
+	}
 
-	resourceId := path.Base(key)
+	err = server.prepareDocument(content, key)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	contentId, prs := jsonContent["id"]
-	if prs {
-		if contentId != resourceId {
-			message := fmt.Sprintf("Mismatch between id field `%s` and address `%s`", contentId, resourceId)
+	current, exists, err := server.store.Get(request.Context(), key)
+	if err != nil {
+		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if status := checkPreconditions(request, currentVersion(current), exists); status != 0 {
+		respondToFailedPrecondition(writer, status, currentVersion(current))
+		return
+	}
+
+	err = server.manageFields(request, content, current)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if server.rejectsContent(writer, key, content) {
+		return
+	}
+
+	// Valid JSON
+	document, err := server.store.Put(request.Context(), key, content)
+	if err != nil {
+		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	server.setManagedHeaders(writer, content)
+	setEntityTag(writer, document.Version)
+	writer.WriteHeader(http.StatusAccepted)
+	server.respond(writer, "")
+}
+
+// isCollectionRequest indicates if a request addresses a collection, which is the case when
+// the URL ends with a slash, or when there are documents in a collection at the key.
+func (server *Server) isCollectionRequest(request *http.Request, key string) (bool, error) {
+
+	if strings.HasSuffix(request.URL.Path, "/") {
+		return true, nil
+	}
+
+	documents, err := server.store.List(request.Context(), key)
+	if err != nil {
+		return false, err
+	}
+
+	return len(documents) > 0, nil
+}
+
+// replaceCollection replaces all documents in the collection at the key with the items, which must be JSON objects.
+func (server *Server) replaceCollection(writer http.ResponseWriter, request *http.Request, key string, items []interface{}) {
+
+	existing, err := server.store.List(request.Context(), key)
+	if err != nil {
+		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	current := make(map[string]*storage.Document, len(existing))
+	for _, document := range existing {
+		current[path.Base(document.Key)] = document
+	}
+
+	contents := make(map[string]interface{}, len(items))
+	var violations []schemaViolation
+
+	for index, item := range items {
+
+		jsonItem, isObject := item.(map[string]interface{})
+		if !isObject {
+			message := fmt.Sprintf("Item %d is %s, only JSON objects can be stored in a collection", index, describeJSON(item))
 			http.Error(writer, message, http.StatusBadRequest)
 			return
 		}
-	} else {
-		jsonContent["id"] = resourceId
+
+		id, present := jsonItem[server.idField]
+		if !present {
+			id, err = server.ids.generate(request.Context(), key, jsonItem)
+			if err != nil {
+				http.Error(writer, fmt.Sprintf("Item %d: %s", index, err.Error()), http.StatusBadRequest)
+				return
+			}
+			jsonItem[server.idField] = id
+		}
+
+		name := idName(id)
+		if err := checkId(name); err != nil {
+			http.Error(writer, fmt.Sprintf("Item %d has invalid id `%s`, %s", index, name, err.Error()), http.StatusBadRequest)
+			return
+		}
+
+		if _, duplicate := contents[name]; duplicate {
+			http.Error(writer, fmt.Sprintf("Item %d has duplicate id `%s`", index, name), http.StatusBadRequest)
+			return
+		}
+
+		err = server.manageFields(request, jsonItem, current[name])
+		if err != nil {
+			http.Error(writer, fmt.Sprintf("Item %d: %s", index, err.Error()), http.StatusBadRequest)
+			return
+		}
+
+		contents[name] = jsonItem
+		violations = append(violations, server.schemas.check(path.Join(key, name), jsonItem, fmt.Sprintf("/%d", index))...)
 	}
 
-	// Valid JSON
-	err = storage.Store(key, content)
+	if len(violations) > 0 {
+		server.respondWithViolations(writer, violations)
+		return
+	}
+
+	documents, err := server.store.Replace(request.Context(), key, contents)
 	if err != nil {
 		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
 
+	writer.Header().Set("X-Total-Count", strconv.Itoa(len(documents)))
 	writer.WriteHeader(http.StatusAccepted)
-	respond(writer, "")
+	server.respond(writer, "")
+}
+
+// prepareDocument checks that the content can be stored as document at the key. Objects get an id that matches
+// the key, other JSON values are stored as they are, unless the server only accepts objects.
+func (server *Server) prepareDocument(content interface{}, key string) error {
+
+	if jsonContent, isObject := content.(map[string]interface{}); isObject {
+		return ensureId(jsonContent, key, server.idField)
+	}
+
+	if server.objectsOnly {
+		return fmt.Errorf("Only JSON objects can be stored, received %s", describeJSON(content))
+	}
+
+	return nil
+}
+
+// describeJSON describes the type of a decoded JSON value, for use in error messages.
+func describeJSON(content interface{}) string {
+
+	switch content.(type) {
+	case map[string]interface{}:
+		return "an object"
+	case []interface{}:
+		return "an array"
+	case string:
+		return "a string"
+	case float64:
+		return "a number"
+	case bool:
+		return "a boolean"
+	default:
+		return "null"
+	}
+}
+
+// ensureId checks that the id field of the content matches the address it is stored at.
+// When the content does not have an id, it is derived from the address.
+func ensureId(content map[string]interface{}, key string, field string) error {
+
+	resourceId := path.Base(key)
+
+	contentId, prs := content[field]
+	if prs {
+		if idName(contentId) != resourceId {
+			return fmt.Errorf("Mismatch between %s field `%v` and address `%s`", field, contentId, resourceId)
+		}
+	} else {
+		content[field] = resourceId
+	}
+
+	return nil
 }
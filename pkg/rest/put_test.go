@@ -0,0 +1,97 @@
+package rest
+
+import (
+	"github.com/akleinloog/lazy-rest/pkg/storage"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+)
+
+func TestPutStoresNonObjectsAsTheyAre(t *testing.T) {
+
+	server := newTestServer(t)
+
+	for _, content := range []string{`["a","b"]`, `"text"`, `42`, `true`, `null`} {
+		response, _ := send(t, "PUT", server.URL+"/values/1", content)
+		assert.Equal(t, http.StatusAccepted, response.StatusCode, content)
+
+		response, body := send(t, "GET", server.URL+"/values/1", "")
+		assert.Equal(t, http.StatusOK, response.StatusCode, content)
+		assert.JSONEq(t, content, body)
+	}
+}
+
+func TestPutRejectsNonObjectsWhenObjectsOnly(t *testing.T) {
+
+	server := newTestServer(t, WithObjectsOnly())
+
+	response, body := send(t, "PUT", server.URL+"/values/1", `["a","b"]`)
+
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+	assert.Contains(t, body, "Only JSON objects can be stored, received an array")
+}
+
+func TestPutArrayReplacesCollection(t *testing.T) {
+
+	server := newTestServer(t, WithSeed(map[string]interface{}{
+		"items/1": map[string]interface{}{"id": "1", "name": "First"},
+		"items/2": map[string]interface{}{"id": "2", "name": "Second"},
+	}))
+
+	response, _ := send(t, "PUT", server.URL+"/items", `[{"id":"2","name":"Replaced"},{"id":"3","name":"Third"}]`)
+	assert.Equal(t, http.StatusAccepted, response.StatusCode)
+	assert.Equal(t, "2", response.Header.Get("X-Total-Count"))
+
+	response, body := send(t, "GET", server.URL+"/items", "")
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.JSONEq(t, `[{"id":"2","name":"Replaced"},{"id":"3","name":"Third"}]`, body)
+}
+
+func TestPutArrayWithNonObjectsLeavesCollectionIntact(t *testing.T) {
+
+	server := newTestServer(t, WithSeed(map[string]interface{}{
+		"items/1": map[string]interface{}{"id": "1"},
+	}))
+
+	response, body := send(t, "PUT", server.URL+"/items/", `[{"id":"2"},"text"]`)
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+	assert.Contains(t, body, "Item 1 is a string")
+
+	_, body = send(t, "GET", server.URL+"/items", "")
+	assert.JSONEq(t, `[{"id":"1"}]`, body)
+}
+
+func TestItemsAndSubCollectionsCoexist(t *testing.T) {
+
+	directory, err := ioutil.TempDir("", "lazy-rest")
+	if !assert.NoError(t, err, "Error occurred while creating test directory") {
+		return
+	}
+	defer os.RemoveAll(directory)
+
+	store, err := storage.NewFileStore(directory)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	server := newTestServer(t, WithStore(store))
+
+	response, _ := send(t, "PUT", server.URL+"/items/1", `{"id":"1"}`)
+	assert.Equal(t, http.StatusAccepted, response.StatusCode)
+	response, _ = send(t, "PUT", server.URL+"/items/1/comments/a", `{"id":"a"}`)
+	assert.Equal(t, http.StatusAccepted, response.StatusCode, "A sub-collection should be stored below an item")
+
+	response, body := send(t, "GET", server.URL+"/items/1", "")
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.JSONEq(t, `{"id":"1"}`, body, "The item should remain next to its sub-collection")
+
+	response, body = send(t, "GET", server.URL+"/items/1/comments/", "")
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.JSONEq(t, `[{"id":"a"}]`, body)
+
+	response, body = send(t, "GET", server.URL+"/items/", "")
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.JSONEq(t, `[{"id":"1"}]`, body, "Sub-collections should not be listed as items")
+}
@@ -0,0 +1,423 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/akleinloog/lazy-rest/pkg/storage"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+)
+
+// schemasPath is the path of the endpoint that manages the JSON Schemas items are validated against.
+const schemasPath = "/_schemas"
+
+// schemasPrefix is the reserved collection that schemas registered with the endpoint are kept in.
+const schemasPrefix = storage.ReservedPrefix + "schemas"
+
+// WithSchema validates the items in the collections that match the pattern against a JSON Schema, draft 2020-12 by default.
+// Patterns are collection paths like /api/users, where * matches any name, like in /api/users/*/roles.
+func WithSchema(pattern string, schema []byte) Option {
+	return func(server *Server) {
+		server.schemaSources[normalizePattern(pattern)] = schema
+	}
+}
+
+// WithStrictSchemas makes the server reject items for collections that no schema is registered for.
+func WithStrictSchemas() Option {
+	return func(server *Server) {
+		server.strictSchemas = true
+	}
+}
+
+// schemaViolation is a part of an item that does not match the schema of its collection,
+// located by a JSON Pointer into the request body.
+type schemaViolation struct {
+	Pointer string `json:"pointer"`
+	Message string `json:"message"`
+}
+
+// registeredSchema is a compiled JSON Schema, together with the pattern of the collections it applies to.
+type registeredSchema struct {
+	pattern  string
+	source   interface{}
+	compiled *jsonschema.Schema
+}
+
+// schemaRecord is a schema as it is kept in the store.
+type schemaRecord struct {
+	Pattern string      `json:"pattern"`
+	Schema  interface{} `json:"schema"`
+}
+
+// schemas holds the JSON Schemas that items are validated against, by the pattern of the collections they apply to.
+// Schemas that are registered with the endpoint are kept in a store, so they survive restarts with file storage.
+type schemas struct {
+	store      storage.Store
+	strict     bool
+	mutex      sync.RWMutex
+	registered map[string]*registeredSchema
+}
+
+// newSchemas returns the schemas from the sources by pattern, together with the schemas that were kept in the store,
+// which take precedence.
+func newSchemas(store storage.Store, sources map[string][]byte, strict bool) (*schemas, error) {
+
+	registry := &schemas{store: store, strict: strict, registered: make(map[string]*registeredSchema)}
+
+	for pattern, source := range sources {
+		schema, err := compileSchema(pattern, source)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schema for `%s`: %w", pattern, err)
+		}
+		registry.registered[pattern] = schema
+	}
+
+	documents, err := store.List(context.Background(), schemasPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, document := range documents {
+		var record schemaRecord
+		err = storage.Convert(document.Content, &record)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stored schema `%s`: %w", document.Key, err)
+		}
+		source, err := json.Marshal(record.Schema)
+		if err != nil {
+			return nil, err
+		}
+		schema, err := compileSchema(record.Pattern, source)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stored schema for `%s`: %w", record.Pattern, err)
+		}
+		registry.registered[record.Pattern] = schema
+	}
+
+	return registry, nil
+}
+
+// compileSchema compiles a JSON Schema for the pattern. References to other documents are not resolved,
+// so schemas can not be used to read files or URLs.
+func compileSchema(pattern string, source []byte) (*registeredSchema, error) {
+
+	var decoded interface{}
+	err := json.Unmarshal(source, &decoded)
+	if err != nil {
+		return nil, err
+	}
+
+	compiler := jsonschema.NewCompiler()
+	compiler.Draft = jsonschema.Draft2020
+	compiler.AssertFormat = true
+	compiler.LoadURL = func(url string) (io.ReadCloser, error) {
+		return nil, fmt.Errorf("references to other documents, like `%s`, are not supported", url)
+	}
+
+	url := "mem:///_schemas" + pattern
+	err = compiler.AddResource(url, bytes.NewReader(source))
+	if err != nil {
+		return nil, err
+	}
+
+	compiled, err := compiler.Compile(url)
+	if err != nil {
+		return nil, err
+	}
+
+	return &registeredSchema{pattern: pattern, source: decoded, compiled: compiled}, nil
+}
+
+// normalizePattern returns a pattern with a leading slash and without trailing slash, like /api/users.
+func normalizePattern(pattern string) string {
+	return "/" + strings.Trim(pattern, "/")
+}
+
+// matchesPattern indicates if the pattern matches the path of a collection, where * matches any name.
+func matchesPattern(pattern string, collection string) bool {
+
+	patternSegments := strings.Split(strings.Trim(pattern, "/"), "/")
+	collectionSegments := strings.Split(strings.Trim(collection, "/"), "/")
+
+	if len(patternSegments) != len(collectionSegments) {
+		return false
+	}
+
+	for index, segment := range patternSegments {
+		if segment != "*" && segment != collectionSegments[index] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// schemaFor returns the schema for the items in the collection at the key, or nil when there is none.
+// When several patterns match, the one with the fewest wildcards applies.
+func (registry *schemas) schemaFor(collection string) *registeredSchema {
+
+	registry.mutex.RLock()
+	defer registry.mutex.RUnlock()
+
+	var found *registeredSchema
+	for pattern, schema := range registry.registered {
+		if !matchesPattern(pattern, collection) {
+			continue
+		}
+		if found == nil || strings.Count(pattern, "*") < strings.Count(found.pattern, "*") ||
+			(strings.Count(pattern, "*") == strings.Count(found.pattern, "*") && pattern < found.pattern) {
+			found = schema
+		}
+	}
+
+	return found
+}
+
+// check returns the parts of the content to be stored at the key that do not match the schema of its collection,
+// with pointers that start with the prefix. In strict mode, content for collections without schema is rejected.
+func (registry *schemas) check(key string, content interface{}, prefix string) []schemaViolation {
+
+	collection := collectionOf(key)
+
+	schema := registry.schemaFor(collection)
+	if schema == nil {
+		return registry.checkStrict(collection, prefix)
+	}
+
+	err := schema.compiled.Validate(content)
+
+	var validationError *jsonschema.ValidationError
+	if !errors.As(err, &validationError) {
+		return nil
+	}
+
+	return violationsOf(validationError, prefix)
+}
+
+// checkData returns a violation when data that is not JSON is stored at the key, while its collection has a schema
+// or the server is strict, as such data can not be validated.
+func (registry *schemas) checkData(key string, prefix string) []schemaViolation {
+
+	collection := collectionOf(key)
+
+	if registry.schemaFor(collection) == nil {
+		return registry.checkStrict(collection, prefix)
+	}
+
+	return []schemaViolation{{Pointer: prefix, Message: "Content is not JSON, so it can not be validated against the schema"}}
+}
+
+// checkStrict returns a violation for content in a collection without schema when the server is strict.
+func (registry *schemas) checkStrict(collection string, prefix string) []schemaViolation {
+
+	if !registry.strict {
+		return nil
+	}
+
+	return []schemaViolation{{Pointer: prefix, Message: fmt.Sprintf("No schema is registered for `%s`", collection)}}
+}
+
+// collectionOf returns the path of the collection that holds the document at the key, like /api/users.
+func collectionOf(key string) string {
+
+	collection := path.Dir(key)
+	if collection == "." {
+		return "/"
+	}
+
+	return "/" + collection
+}
+
+// violationsOf returns the errors that caused a validation error, which are the ones without causes themselves.
+func violationsOf(validationError *jsonschema.ValidationError, prefix string) []schemaViolation {
+
+	if len(validationError.Causes) == 0 {
+		return []schemaViolation{{Pointer: prefix + validationError.InstanceLocation, Message: validationError.Message}}
+	}
+
+	var violations []schemaViolation
+	for _, cause := range validationError.Causes {
+		violations = append(violations, violationsOf(cause, prefix)...)
+	}
+
+	return violations
+}
+
+// respondWithViolations responds with 422 Unprocessable Entity, listing the parts of the body that do not match
+// the schemas of their collections.
+func (server *Server) respondWithViolations(writer http.ResponseWriter, violations []schemaViolation) {
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusUnprocessableEntity)
+
+	err := json.NewEncoder(writer).Encode(map[string]interface{}{
+		"message": "Content does not match the schema of its collection",
+		"errors":  violations,
+	})
+	if err != nil {
+		server.log.Error(err, "Error while responding to request")
+	}
+}
+
+// rejectsContent checks the content to be stored at the key against the schema of its collection,
+// and responds with the violations when it does not match.
+func (server *Server) rejectsContent(writer http.ResponseWriter, key string, content interface{}) bool {
+
+	violations := server.schemas.check(key, content, "")
+	if len(violations) > 0 {
+		server.respondWithViolations(writer, violations)
+		return true
+	}
+
+	return false
+}
+
+// rejectsData checks if data that is not JSON can be stored at the key, and responds with the violation when it can not.
+func (server *Server) rejectsData(writer http.ResponseWriter, key string) bool {
+
+	violations := server.schemas.checkData(key, "")
+	if len(violations) > 0 {
+		server.respondWithViolations(writer, violations)
+		return true
+	}
+
+	return false
+}
+
+// isSchemasPath indicates if a path is that of the schemas endpoint, or of a schema in it.
+func isSchemasPath(requestPath string) bool {
+	return requestPath == schemasPath || strings.HasPrefix(requestPath, schemasPath+"/")
+}
+
+// handleSchemas lists, returns, registers and removes schemas. The path below the endpoint is the pattern of the
+// collections a schema applies to, like PUT /_schemas/api/users/*/roles.
+func (server *Server) handleSchemas(writer http.ResponseWriter, request *http.Request) {
+
+	registry := server.schemas
+	pattern := normalizePattern(strings.TrimPrefix(request.URL.Path, schemasPath))
+
+	switch request.Method {
+	case "GET", "HEAD":
+		if pattern == "/" {
+			server.respondWithContent(writer, request, registry.sources())
+			return
+		}
+		source, exists := registry.source(pattern)
+		if !exists {
+			http.Error(writer, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+		server.respondWithContent(writer, request, source)
+	case "PUT":
+		body, err := ioutil.ReadAll(request.Body)
+		if err != nil {
+			http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+		err = registry.register(request.Context(), pattern, body)
+		if err != nil {
+			http.Error(writer, fmt.Sprintf("Invalid schema for `%s`: %s", pattern, err.Error()), http.StatusBadRequest)
+			return
+		}
+		writer.WriteHeader(http.StatusAccepted)
+		server.respond(writer, "")
+	case "DELETE":
+		wasPresent, err := registry.remove(request.Context(), pattern)
+		if err != nil {
+			http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		if !wasPresent {
+			http.Error(writer, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+		writer.WriteHeader(http.StatusAccepted)
+		server.respond(writer, "")
+	}
+}
+
+// sources returns the registered schemas by pattern.
+func (registry *schemas) sources() map[string]interface{} {
+
+	registry.mutex.RLock()
+	defer registry.mutex.RUnlock()
+
+	sources := make(map[string]interface{}, len(registry.registered))
+	for pattern, schema := range registry.registered {
+		sources[pattern] = schema.source
+	}
+
+	return sources
+}
+
+// source returns the schema that is registered for the pattern, and indicates if there is one.
+func (registry *schemas) source(pattern string) (interface{}, bool) {
+
+	registry.mutex.RLock()
+	defer registry.mutex.RUnlock()
+
+	schema, exists := registry.registered[pattern]
+	if !exists {
+		return nil, false
+	}
+
+	return schema.source, true
+}
+
+// register compiles the schema for the pattern, keeps it in the store and starts validating against it.
+func (registry *schemas) register(ctx context.Context, pattern string, source []byte) error {
+
+	if pattern == "/" {
+		return fmt.Errorf("a schema needs the pattern of the collections it applies to")
+	}
+
+	schema, err := compileSchema(pattern, source)
+	if err != nil {
+		return err
+	}
+
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	_, err = registry.store.Put(ctx, schemaRecordKey(pattern), schemaRecord{Pattern: pattern, Schema: schema.source})
+	if err != nil {
+		return err
+	}
+
+	registry.registered[pattern] = schema
+
+	return nil
+}
+
+// remove stops validating against the schema for the pattern, and indicates if there was one.
+func (registry *schemas) remove(ctx context.Context, pattern string) (bool, error) {
+
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	_, err := registry.store.Delete(ctx, schemaRecordKey(pattern))
+	if err != nil {
+		return false, err
+	}
+
+	_, exists := registry.registered[pattern]
+	delete(registry.registered, pattern)
+
+	return exists, nil
+}
+
+// schemaRecordKey returns the key the schema for the pattern is kept at.
+func schemaRecordKey(pattern string) string {
+	hash := sha256.Sum256([]byte(pattern))
+	return path.Join(schemasPrefix, hex.EncodeToString(hash[:]))
+}
@@ -0,0 +1,145 @@
+package rest
+
+import (
+	"encoding/json"
+	"github.com/akleinloog/lazy-rest/pkg/storage"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+const userSchema = `{
+	"$schema": "https://json-schema.org/draft/2020-12/schema",
+	"type": "object",
+	"required": ["id", "name"],
+	"properties": {
+		"id": {"type": "string"},
+		"name": {"type": "string", "minLength": 1},
+		"email": {"type": "string", "format": "email"},
+		"age": {"type": "integer", "minimum": 0}
+	}
+}`
+
+type schemaErrors struct {
+	Message string            `json:"message"`
+	Errors  []schemaViolation `json:"errors"`
+}
+
+func pointers(t *testing.T, body string) []string {
+
+	var response schemaErrors
+	if !assert.NoError(t, json.Unmarshal([]byte(body), &response), "Violations should be returned as JSON") {
+		return nil
+	}
+
+	found := make([]string, 0, len(response.Errors))
+	for _, violation := range response.Errors {
+		assert.NotEmpty(t, violation.Message)
+		found = append(found, violation.Pointer)
+	}
+	return found
+}
+
+func TestMatchesPattern(t *testing.T) {
+	assert.True(t, matchesPattern("/users", "/users"))
+	assert.True(t, matchesPattern("/users/*/roles", "/users/1/roles"))
+	assert.False(t, matchesPattern("/users/*/roles", "/users/roles"))
+	assert.False(t, matchesPattern("/users", "/users/1/roles"))
+	assert.True(t, matchesPattern("/", "/"))
+}
+
+func TestItemsAreValidatedAgainstSchema(t *testing.T) {
+
+	server := newTestServer(t, WithSchema("/users", []byte(userSchema)))
+
+	response, _ := send(t, "PUT", server.URL+"/users/1", `{"name":"Alice","email":"alice@example.com"}`)
+	assert.Equal(t, http.StatusAccepted, response.StatusCode, "Valid items should be stored")
+
+	response, body := send(t, "PUT", server.URL+"/users/2", `{"name":"","email":"nope","age":-1}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, response.StatusCode)
+	assert.ElementsMatch(t, []string{"/name", "/email", "/age"}, pointers(t, body), "Violations should be located by JSON Pointers")
+
+	response, _ = send(t, "GET", server.URL+"/users/2", "")
+	assert.Equal(t, http.StatusNotFound, response.StatusCode, "Invalid items should not be stored")
+
+	response, body = send(t, "PATCH", server.URL+"/users/1", `{"age":"old"}`, "Content-Type", mergePatchContentType)
+	assert.Equal(t, http.StatusUnprocessableEntity, response.StatusCode, "Patched items should be validated")
+	assert.Equal(t, []string{"/age"}, pointers(t, body))
+
+	response, body = send(t, "POST", server.URL+"/users", `[{"id":"3","name":"Carol"},{"id":"4"},{"id":"5","age":1.5,"name":"Eve"}]`)
+	assert.Equal(t, http.StatusUnprocessableEntity, response.StatusCode)
+	assert.ElementsMatch(t, []string{"/1", "/2/age"}, pointers(t, body), "Pointers should locate the items in the body")
+
+	response, _ = send(t, "GET", server.URL+"/users/3", "")
+	assert.Equal(t, http.StatusNotFound, response.StatusCode, "No items should be stored when any of them is invalid")
+
+	response, body = send(t, "PUT", server.URL+"/users/", `[{"id":"1","name":"Alice"},{"id":"2","name":7}]`)
+	assert.Equal(t, http.StatusUnprocessableEntity, response.StatusCode)
+	assert.Equal(t, []string{"/1/name"}, pointers(t, body))
+
+	response, _ = send(t, "PUT", server.URL+"/users/6", "plain text", "Content-Type", "text/plain")
+	assert.Equal(t, http.StatusUnprocessableEntity, response.StatusCode, "Data that is not JSON can not be validated")
+
+	response, _ = send(t, "PUT", server.URL+"/other/1", `{"anything":true}`)
+	assert.Equal(t, http.StatusAccepted, response.StatusCode, "Collections without schema should accept anything")
+}
+
+func TestStrictSchemas(t *testing.T) {
+
+	server := newTestServer(t, WithStrictSchemas(), WithSchema("/users/*/roles", []byte(`{"type":"object"}`)))
+
+	response, _ := send(t, "PUT", server.URL+"/users/1/roles/admin", `{}`)
+	assert.Equal(t, http.StatusAccepted, response.StatusCode)
+
+	response, body := send(t, "PUT", server.URL+"/other/1", `{}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, response.StatusCode, "Collections without schema should be rejected")
+	assert.Equal(t, []string{""}, pointers(t, body))
+}
+
+func TestInvalidSchemasAreRejected(t *testing.T) {
+
+	_, err := New(WithLogger(&quietLog), WithSchema("/users", []byte(`{"type":"unknown"}`)))
+	assert.Error(t, err)
+
+	_, err = New(WithLogger(&quietLog), WithSchema("/users", []byte(`{"$ref":"file:///etc/passwd"}`)))
+	assert.Error(t, err, "References to other documents should not be resolved")
+}
+
+func TestSchemasEndpoint(t *testing.T) {
+
+	store := storage.NewMemoryStore()
+	server := newTestServer(t, WithStore(store))
+
+	response, _ := send(t, "PUT", server.URL+"/_schemas/users", userSchema)
+	assert.Equal(t, http.StatusAccepted, response.StatusCode)
+
+	response, _ = send(t, "PUT", server.URL+"/_schemas/users/*/roles", `{"type":"nonsense"}`)
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode, "Invalid schemas should be rejected")
+
+	response, body := send(t, "GET", server.URL+"/_schemas/users", "")
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.JSONEq(t, userSchema, body)
+
+	response, body = send(t, "GET", server.URL+"/_schemas", "")
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.JSONEq(t, `{"/users":`+userSchema+`}`, body)
+
+	response, _ = send(t, "PUT", server.URL+"/users/1", `{"name":7}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, response.StatusCode, "Registered schemas should be used")
+
+	restarted := newTestServer(t, WithStore(store))
+	response, _ = send(t, "PUT", restarted.URL+"/users/1", `{"name":7}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, response.StatusCode, "Registered schemas should be kept in the store")
+
+	response, _ = send(t, "DELETE", server.URL+"/_schemas/users", "")
+	assert.Equal(t, http.StatusAccepted, response.StatusCode)
+
+	response, _ = send(t, "PUT", server.URL+"/users/1", `{"name":7}`)
+	assert.Equal(t, http.StatusAccepted, response.StatusCode, "Removed schemas should no longer be used")
+
+	response, _ = send(t, "DELETE", server.URL+"/_schemas/users", "")
+	assert.Equal(t, http.StatusNotFound, response.StatusCode)
+
+	response, _ = send(t, "PATCH", server.URL+"/_schemas/users", "{}")
+	assert.Equal(t, http.StatusMethodNotAllowed, response.StatusCode)
+}
@@ -0,0 +1,397 @@
+package rest
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"github.com/akleinloog/lazy-rest/app"
+	"github.com/akleinloog/lazy-rest/pkg/logger"
+	"github.com/akleinloog/lazy-rest/pkg/storage"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Server handles REST requests, storing what is put in and returning it when requested.
+// It can be embedded in other applications and tests, every server has its own store and handler.
+type Server struct {
+	store             storage.Store
+	log               *logger.Logger
+	host              string
+	port              int
+	seed              map[string]interface{}
+	timeouts          Timeouts
+	handler           http.Handler
+	httpServer        *http.Server
+	endpoints         []endpoint
+	tlsConfig         *tls.Config
+	tlsPort           int
+	separateTLSPort   bool
+	cors              *CORS
+	objectsOnly       bool
+	readOnly          bool
+	upsert            bool
+	idempotency       *idempotency
+	idempotencyWindow time.Duration
+	locks             *keyLocks
+	history           *storage.Retention
+	managed           *ManagedFields
+	idField           string
+	idStrategies      map[string]string
+	ids               *ids
+	schemaSources     map[string][]byte
+	strictSchemas     bool
+	schemas           *schemas
+}
+
+// Timeouts limits how long the server spends on connections and requests.
+type Timeouts struct {
+	Read           time.Duration
+	Write          time.Duration
+	Idle           time.Duration
+	Shutdown       time.Duration
+	MaxHeaderBytes int
+}
+
+// Option configures a Server.
+type Option func(server *Server)
+
+// WithHost sets the host name or IP address the server binds to, by default it binds to all interfaces.
+func WithHost(host string) Option {
+	return func(server *Server) {
+		server.host = host
+	}
+}
+
+// WithPort sets the port the server listens on, use 0 to pick a free port.
+func WithPort(port int) Option {
+	return func(server *Server) {
+		server.port = port
+	}
+}
+
+// WithStore sets the store the server keeps its documents in.
+func WithStore(store storage.Store) Option {
+	return func(server *Server) {
+		server.store = store
+	}
+}
+
+// WithMemoryStore makes the server keep its documents in memory, which is the default.
+func WithMemoryStore() Option {
+	return func(server *Server) {
+		server.store = storage.NewMemoryStore()
+	}
+}
+
+// WithSeed stores the documents in the server when it is created, the map holds the content per path.
+func WithSeed(documents map[string]interface{}) Option {
+	return func(server *Server) {
+		for key, content := range documents {
+			server.seed[key] = content
+		}
+	}
+}
+
+// WithTLS makes the server use TLS with the configuration, which must hold the certificate to serve.
+func WithTLS(tlsConfig *tls.Config) Option {
+	return func(server *Server) {
+		server.tlsConfig = tlsConfig
+	}
+}
+
+// WithTLSPort makes the server accept HTTPS on a separate port, next to HTTP on its regular port.
+// It only has effect in combination with WithTLS, use 0 to pick a free port.
+func WithTLSPort(port int) Option {
+	return func(server *Server) {
+		server.tlsPort = port
+		server.separateTLSPort = true
+	}
+}
+
+// WithObjectsOnly makes the server reject documents that are not JSON objects, like arrays, strings, numbers and null.
+// By default these are stored as they are, without adding an id.
+func WithObjectsOnly() Option {
+	return func(server *Server) {
+		server.objectsOnly = true
+	}
+}
+
+// WithReadOnly makes the server reject requests that change documents with 405 Method Not Allowed,
+// so it only serves what is in its store.
+func WithReadOnly() Option {
+	return func(server *Server) {
+		server.readOnly = true
+	}
+}
+
+// WithUpsert makes POST replace items that already exist, instead of responding with 409 Conflict.
+// Clients can also ask for this per request with a Prefer: resolution=merge-duplicates header.
+func WithUpsert() Option {
+	return func(server *Server) {
+		server.upsert = true
+	}
+}
+
+// WithTimeouts sets the timeouts of the server, zero values keep the defaults.
+func WithTimeouts(timeouts Timeouts) Option {
+	return func(server *Server) {
+		if timeouts.Read != 0 {
+			server.timeouts.Read = timeouts.Read
+		}
+		if timeouts.Write != 0 {
+			server.timeouts.Write = timeouts.Write
+		}
+		if timeouts.Idle != 0 {
+			server.timeouts.Idle = timeouts.Idle
+		}
+		if timeouts.Shutdown != 0 {
+			server.timeouts.Shutdown = timeouts.Shutdown
+		}
+		if timeouts.MaxHeaderBytes != 0 {
+			server.timeouts.MaxHeaderBytes = timeouts.MaxHeaderBytes
+		}
+	}
+}
+
+// WithLogger sets the logger that requests and errors are logged to.
+func WithLogger(log *logger.Logger) Option {
+	return func(server *Server) {
+		server.log = log
+	}
+}
+
+// New returns a server configured with the options. By default it listens on port 8080,
+// keeps its documents in memory and logs to the application log.
+func New(options ...Option) (*Server, error) {
+
+	server := &Server{
+		store:             storage.NewMemoryStore(),
+		log:               &app.Log,
+		port:              8080,
+		seed:              make(map[string]interface{}),
+		idField:           "id",
+		idStrategies:      make(map[string]string),
+		schemaSources:     make(map[string][]byte),
+		idempotencyWindow: defaultIdempotencyWindow,
+		locks:             newKeyLocks(),
+		timeouts: Timeouts{
+			Read:           30 * time.Second,
+			Write:          60 * time.Second,
+			Idle:           120 * time.Second,
+			Shutdown:       30 * time.Second,
+			MaxHeaderBytes: http.DefaultMaxHeaderBytes,
+		},
+	}
+
+	for _, option := range options {
+		option(server)
+	}
+
+	if server.managed != nil {
+		err := server.managed.validate()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if server.idempotencyWindow > 0 {
+		// Responses are kept next to the documents, without recording them in their history
+		server.idempotency = newIdempotency(server.store, server.idempotencyWindow)
+	}
+
+	// Schemas are kept next to the documents as well
+	schemas, err := newSchemas(server.store, server.schemaSources, server.strictSchemas)
+	if err != nil {
+		return nil, err
+	}
+	server.schemas = schemas
+
+	if server.history != nil {
+		server.store = storage.NewHistoryStore(server.store, *server.history)
+	}
+
+	if server.idField == "" {
+		return nil, fmt.Errorf("the id field needs a name")
+	}
+
+	ids, err := newIDs(server.idStrategies, server.store)
+	if err != nil {
+		return nil, err
+	}
+	server.ids = ids
+
+	if server.tlsConfig != nil && len(server.tlsConfig.NextProtos) == 0 {
+		// Advertise HTTP/2 explicitly, as it is only configured automatically when serving TLS exclusively
+		server.tlsConfig = server.tlsConfig.Clone()
+		server.tlsConfig.NextProtos = []string{"h2", "http/1.1"}
+	}
+
+	server.handler = server.requestLogger(server.corsHandler(http.HandlerFunc(server.HandleRequest)))
+	server.httpServer = &http.Server{
+		Handler:        server.handler,
+		ReadTimeout:    server.timeouts.Read,
+		WriteTimeout:   server.timeouts.Write,
+		IdleTimeout:    server.timeouts.Idle,
+		MaxHeaderBytes: server.timeouts.MaxHeaderBytes,
+		TLSConfig:      server.tlsConfig,
+	}
+
+	err = server.seedStore()
+	if err != nil {
+		return nil, err
+	}
+
+	return server, nil
+}
+
+// seedStore stores the seed documents, in order of their keys.
+func (server *Server) seedStore() error {
+
+	keys := make([]string, 0, len(server.seed))
+	for key := range server.seed {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		_, err := server.store.Put(context.Background(), strings.Trim(key, "/"), server.seed[key])
+		if err != nil {
+			return fmt.Errorf("unable to seed `%s`: %w", key, err)
+		}
+	}
+
+	return nil
+}
+
+// Handler returns the http.Handler that serves the requests, for use with httptest.NewServer or another mux.
+func (server *Server) Handler() http.Handler {
+	return server.handler
+}
+
+// ServeHTTP serves a single request, so the server itself can be used as http.Handler.
+func (server *Server) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	server.handler.ServeHTTP(writer, request)
+}
+
+// Start starts accepting requests in the background, it returns once the server is listening.
+func (server *Server) Start() error {
+
+	err := server.listen()
+	if err != nil {
+		return err
+	}
+
+	stopped := server.serve()
+
+	go func() {
+		for range server.endpoints {
+			err := <-stopped
+			if err != nil {
+				server.log.Error(err, "Error while serving requests")
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Shutdown stops the server, waiting for requests that are in progress until the context is done.
+func (server *Server) Shutdown(ctx context.Context) error {
+	return server.httpServer.Shutdown(ctx)
+}
+
+// Address returns the address the server is listening on, which is only known once it has been started.
+// When serving HTTP and HTTPS side by side, this is the address for HTTP.
+func (server *Server) Address() string {
+	if len(server.endpoints) == 0 {
+		return ""
+	}
+	return server.endpoints[0].listener.Addr().String()
+}
+
+// URL returns the base URL of the server, which is only known once it has been started.
+// When serving HTTP and HTTPS side by side, this is the URL for HTTP.
+func (server *Server) URL() string {
+	if len(server.endpoints) == 0 {
+		return ""
+	}
+	return server.endpoints[0].url()
+}
+
+// URLs returns the base URLs of all endpoints of the server, which are only known once it has been started.
+func (server *Server) URLs() []string {
+	urls := make([]string, 0, len(server.endpoints))
+	for _, endpoint := range server.endpoints {
+		urls = append(urls, endpoint.url())
+	}
+	return urls
+}
+
+// endpoint is a listener that the server accepts requests on.
+type endpoint struct {
+	listener net.Listener
+	secure   bool
+}
+
+func (endpoint *endpoint) url() string {
+	if endpoint.secure {
+		return "https://" + endpoint.listener.Addr().String()
+	}
+	return "http://" + endpoint.listener.Addr().String()
+}
+
+// listen opens the endpoints of the server. Without TLS, the server listens for HTTP on its port. With TLS,
+// it listens for HTTPS on its port, or for HTTP on its port and HTTPS on the TLS port when that is set.
+func (server *Server) listen() error {
+
+	ports := []int{server.port}
+	secure := []bool{server.tlsConfig != nil}
+
+	if server.tlsConfig != nil && server.separateTLSPort {
+		ports = append(ports, server.tlsPort)
+		secure = []bool{false, true}
+	}
+
+	for index, port := range ports {
+		listener, err := net.Listen("tcp", net.JoinHostPort(server.host, strconv.Itoa(port)))
+		if err != nil {
+			for _, opened := range server.endpoints {
+				opened.listener.Close()
+			}
+			server.endpoints = nil
+			return err
+		}
+		server.endpoints = append(server.endpoints, endpoint{listener: listener, secure: secure[index]})
+	}
+
+	return nil
+}
+
+// serve serves requests on the endpoints in the background, the returned channel receives for every endpoint
+// the error that stopped it, or nil when the server was shut down. HTTP/2 is negotiated on endpoints that use TLS.
+func (server *Server) serve() <-chan error {
+
+	stopped := make(chan error, len(server.endpoints))
+
+	for _, current := range server.endpoints {
+		current := current
+		go func() {
+			var err error
+			if current.secure {
+				err = server.httpServer.ServeTLS(current.listener, "", "")
+			} else {
+				err = server.httpServer.Serve(current.listener)
+			}
+			if err == http.ErrServerClosed {
+				err = nil
+			}
+			stopped <- err
+		}()
+	}
+
+	return stopped
+}
@@ -0,0 +1,157 @@
+package rest
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"github.com/akleinloog/lazy-rest/pkg/certificate"
+	"github.com/akleinloog/lazy-rest/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var quietLog = logger.NewWithWriter(ioutil.Discard)
+
+// newTestServer starts a server with its own in memory store, which is closed when the test ends.
+func newTestServer(t *testing.T, options ...Option) *httptest.Server {
+
+	server, err := New(append([]Option{WithLogger(&quietLog)}, options...)...)
+	if !assert.NoError(t, err, "Error occurred while creating server") {
+		t.FailNow()
+	}
+
+	testServer := httptest.NewServer(server)
+	t.Cleanup(testServer.Close)
+
+	return testServer
+}
+
+// send sends a request to the test server, and returns the response with its body.
+func send(t *testing.T, method string, url string, body string, headers ...string) (*http.Response, string) {
+
+	request, err := http.NewRequest(method, url, strings.NewReader(body))
+	if !assert.NoError(t, err, "Error occurred while creating request") {
+		t.FailNow()
+	}
+
+	for index := 0; index+1 < len(headers); index += 2 {
+		request.Header.Set(headers[index], headers[index+1])
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if !assert.NoError(t, err, "Error occurred while sending request") {
+		t.FailNow()
+	}
+	defer response.Body.Close()
+
+	content, err := ioutil.ReadAll(response.Body)
+	assert.NoError(t, err, "Error occurred while reading response")
+
+	return response, string(content)
+}
+
+func TestServersAreIsolated(t *testing.T) {
+
+	for _, name := range []string{"first", "second", "third"} {
+		name := name
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			server := newTestServer(t)
+
+			response, _ := send(t, "PUT", server.URL+"/items/1", `{"name":"`+name+`"}`)
+			assert.Equal(t, http.StatusAccepted, response.StatusCode)
+
+			response, body := send(t, "GET", server.URL+"/items/1", "")
+			assert.Equal(t, http.StatusOK, response.StatusCode)
+			assert.JSONEq(t, `{"id":"1","name":"`+name+`"}`, body)
+		})
+	}
+}
+
+func TestSeedData(t *testing.T) {
+
+	server := newTestServer(t, WithSeed(map[string]interface{}{
+		"/items/1": map[string]interface{}{"id": "1", "name": "First"},
+		"items/2":  map[string]interface{}{"id": "2", "name": "Second"},
+	}))
+
+	response, body := send(t, "GET", server.URL+"/items?sort=-name", "")
+
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.JSONEq(t, `[{"id":"2","name":"Second"},{"id":"1","name":"First"}]`, body)
+}
+
+func TestStartAndShutdown(t *testing.T) {
+
+	server, err := New(WithPort(0), WithLogger(&quietLog))
+	if !assert.NoError(t, err, "Error occurred while creating server") {
+		return
+	}
+
+	if !assert.NoError(t, server.Start(), "Error occurred while starting server") {
+		return
+	}
+
+	response, _ := send(t, "GET", server.URL()+"/items/1", "")
+	assert.Equal(t, http.StatusNotFound, response.StatusCode)
+
+	assert.NoError(t, server.Shutdown(context.Background()), "Error occurred while shutting down server")
+
+	_, err = http.Get(server.URL() + "/items/1")
+	assert.Error(t, err, "Server should no longer accept requests")
+}
+
+func TestServeHTTP2OverTLSNextToHTTP(t *testing.T) {
+
+	selfSigned, err := certificate.GenerateSelfSigned()
+	if !assert.NoError(t, err, "Error occurred while generating certificate") {
+		return
+	}
+
+	server, err := New(
+		WithPort(0),
+		WithTLS(&tls.Config{Certificates: []tls.Certificate{selfSigned.Certificate}}),
+		WithTLSPort(0),
+		WithLogger(&quietLog),
+	)
+	if !assert.NoError(t, err, "Error occurred while creating server") {
+		return
+	}
+
+	if !assert.NoError(t, server.Start(), "Error occurred while starting server") {
+		return
+	}
+	defer server.Shutdown(context.Background())
+
+	urls := server.URLs()
+	if !assert.Len(t, urls, 2) {
+		return
+	}
+	assert.True(t, strings.HasPrefix(urls[0], "http://"))
+	assert.True(t, strings.HasPrefix(urls[1], "https://"))
+
+	response, _ := send(t, "PUT", urls[0]+"/items/1", `{"name":"Something"}`)
+	assert.Equal(t, http.StatusAccepted, response.StatusCode)
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(selfSigned.CertificateAuthority)
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{RootCAs: roots},
+		ForceAttemptHTTP2: true,
+	}}
+
+	secureURL := strings.Replace(urls[1], "127.0.0.1", "localhost", 1)
+	secureURL = strings.Replace(secureURL, "[::]", "localhost", 1)
+
+	response, err = client.Get(secureURL + "/items/1")
+	if assert.NoError(t, err, "Error occurred while sending request over TLS") {
+		defer response.Body.Close()
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Equal(t, 2, response.ProtoMajor, "HTTP/2 should have been negotiated")
+	}
+}
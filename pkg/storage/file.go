@@ -0,0 +1,735 @@
+/*
+Copyright © 2020 Arnoud Kleinloog
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/akleinloog/lazy-rest/app"
+	"github.com/akleinloog/lazy-rest/pkg/filesystem"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FileStore stores documents as files, collections are directories. A document is stored in a file named after its
+// key with an extension, .json for JSON and .data for other data, so a collection can be stored at the same key.
+type FileStore struct {
+	fs filesystem.Fs
+}
+
+// The extensions of the files that hold documents.
+const (
+	jsonExtension = ".json"
+	dataExtension = ".data"
+)
+
+// ErrLegacyLayout indicates that a data directory holds files in the layout of an older version, without extensions.
+var ErrLegacyLayout = errors.New("data directory uses the layout of an older version")
+
+// NewFileStore returns a store that keeps its files in a directory.
+// The directory is created when it is missing, and must be writable.
+func NewFileStore(directory string) (*FileStore, error) {
+
+	err := prepareDirectory(directory)
+	if err != nil {
+		return nil, err
+	}
+
+	store := &FileStore{fs: filesystem.NewOsFs(directory)}
+
+	err = store.recover()
+	if errors.Is(err, ErrLegacyLayout) {
+		return nil, fmt.Errorf("%w, run `lazy-rest migrate --data-dir %s` to convert `%s`", err, directory, directory)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to recover data directory `%s`: %w", directory, err)
+	}
+
+	return store, nil
+}
+
+// prepareDirectory creates the directory when it is missing, and checks that files can be written in it.
+func prepareDirectory(directory string) error {
+
+	err := os.MkdirAll(directory, 0777)
+	if err != nil {
+		return fmt.Errorf("unable to create data directory `%s`: %w", directory, err)
+	}
+
+	probe, err := ioutil.TempFile(directory, ".lazy-rest-")
+	if err != nil {
+		return fmt.Errorf("data directory `%s` is not writable: %w", directory, err)
+	}
+
+	probe.Close()
+	return os.Remove(probe.Name())
+}
+
+// hiddenPrefix marks files that are not documents themselves, like staged files that are being written,
+// and the metadata of documents that are not JSON.
+const hiddenPrefix = "."
+
+// quarantineDirectory is where files that cannot be read are moved to, so they no longer fail requests.
+const quarantineDirectory = ".quarantine"
+
+// metadataLocation returns the location of the file that holds the metadata of the data stored at a location,
+// which is the location of its file without extension.
+func metadataLocation(location string) string {
+	return path.Join(path.Dir(location), hiddenPrefix+path.Base(location)+".meta")
+}
+
+// readMetadata returns the metadata of the data stored at a location, or nil when there is none.
+func (store *FileStore) readMetadata(location string) (*Metadata, error) {
+
+	bytes, exists, err := store.readFile(metadataLocation(location))
+	if err != nil || !exists {
+		return nil, err
+	}
+
+	var metadata Metadata
+	err = json.Unmarshal(bytes, &metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	return &metadata, nil
+}
+
+// readFile returns the content of a file, and indicates if it exists.
+func (store *FileStore) readFile(location string) ([]byte, bool, error) {
+
+	exists, err := store.fs.Exists(location)
+	if err != nil {
+		app.Log.Error(err, "Error occurred while checking if location exists")
+		return nil, false, err
+	}
+
+	if !exists {
+		return nil, false, nil
+	}
+
+	isDir, err := store.fs.IsDir(location)
+	if err != nil {
+		app.Log.Error(err, "Error occurred while checking if location is a directory")
+		return nil, false, err
+	}
+	if isDir {
+		return nil, false, nil
+	}
+
+	bytes, err := store.fs.ReadFile(location)
+	if err != nil {
+		app.Log.Error(err, "Error occurred while reading content")
+		return nil, true, err
+	}
+
+	return bytes, true, nil
+}
+
+// removeFile removes a file, when it exists.
+func (store *FileStore) removeFile(location string) (bool, error) {
+
+	exists, err := store.fs.Exists(location)
+	if err != nil || !exists {
+		return false, err
+	}
+
+	return true, store.fs.Remove(location)
+}
+
+// Get returns the document stored at the key, and indicates if it exists.
+func (store *FileStore) Get(_ context.Context, key string) (*Document, bool, error) {
+
+	location, err := encodeKey(key)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return store.read(key, location)
+}
+
+// read returns the document stored at the key from the location of its file without extension, and indicates if it exists.
+func (store *FileStore) read(key string, location string) (*Document, bool, error) {
+
+	bytes, exists, err := store.readFile(location + jsonExtension)
+	if err != nil {
+		return nil, exists, err
+	}
+
+	if exists {
+		document, err := decode(key, bytes)
+		if err != nil {
+			return nil, false, store.quarantine(location + jsonExtension)
+		}
+		document.Modified, err = store.fs.ModTime(location + jsonExtension)
+		return document, true, err
+	}
+
+	bytes, exists, err = store.readFile(location + dataExtension)
+	if err != nil || !exists {
+		return nil, exists, err
+	}
+
+	metadata, err := store.readMetadata(location)
+	if err != nil {
+		app.Log.Error(err, "Error occurred while reading metadata")
+		return nil, false, store.quarantine(location + dataExtension)
+	}
+	if metadata == nil {
+		metadata = &Metadata{ContentType: "application/octet-stream"}
+	}
+
+	document := dataDocument(key, bytes, *metadata)
+	document.Modified, err = store.fs.ModTime(location + dataExtension)
+
+	return document, true, err
+}
+
+// recover removes the temporary files that remain after a crash, puts back the documents that an interrupted replace
+// moved aside, and quarantines the documents that cannot be read. Other files, like a README, are ignored.
+// Nothing is changed when the directory holds documents in the layout of an older version.
+func (store *FileStore) recover() error {
+
+	var leftovers, backups, corrupt, legacy []string
+
+	err := store.fs.Walk(".", func(location string, fileInfo os.FileInfo, err error) error {
+
+		if err != nil {
+			return err
+		}
+
+		name := fileInfo.Name()
+
+		switch {
+		case fileInfo.IsDir():
+			if name == quarantineDirectory {
+				return filepath.SkipDir
+			}
+		case filesystem.IsTempFile(name) || (strings.HasPrefix(name, hiddenPrefix) && strings.HasSuffix(name, stagedSuffix)):
+			leftovers = append(leftovers, location)
+		case strings.HasPrefix(name, hiddenPrefix) && strings.HasSuffix(name, backupSuffix):
+			backups = append(backups, location)
+		case strings.HasPrefix(name, hiddenPrefix):
+			// Other hidden files are not documents, metadata is checked together with the data it describes
+		case strings.HasSuffix(name, jsonExtension) || strings.HasSuffix(name, dataExtension):
+			readable, err := store.readable(location)
+			if err != nil {
+				return err
+			}
+			if !readable {
+				corrupt = append(corrupt, location)
+			}
+		default:
+			isLegacy, err := isLegacyDocument(store.fs, location, fileInfo)
+			if err != nil {
+				return err
+			}
+			if isLegacy {
+				legacy = append(legacy, location)
+			} else {
+				app.Log.Warn().Str("location", location).Msg("Ignored a file in the data directory that is not a document")
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(legacy) > 0 {
+		return fmt.Errorf("%w, like `%s`", ErrLegacyLayout, legacy[0])
+	}
+
+	for _, location := range leftovers {
+		err = store.fs.Remove(location)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, backup := range backups {
+		err = store.restore(backup)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, location := range corrupt {
+		err = store.quarantine(location)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// restore puts back a file that was moved aside while its collection was replaced, unless it was replaced already.
+func (store *FileStore) restore(backup string) error {
+
+	exists, err := store.fs.Exists(backupOriginal(backup))
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return store.fs.Remove(backup)
+	}
+
+	app.Log.Warn().Str("location", backupOriginal(backup)).Msg("Restored a document of an interrupted replace")
+	return store.fs.Rename(backup, backupOriginal(backup))
+}
+
+// readable indicates if the document in a file can be read.
+func (store *FileStore) readable(location string) (bool, error) {
+
+	if strings.HasSuffix(location, dataExtension) {
+		_, err := store.readMetadata(strings.TrimSuffix(location, dataExtension))
+		return err == nil, nil
+	}
+
+	bytes, err := store.fs.ReadFile(location)
+	if err != nil {
+		return false, err
+	}
+
+	return json.Valid(bytes), nil
+}
+
+// quarantine moves a file that cannot be read out of the way, together with its metadata, so it is no longer found.
+func (store *FileStore) quarantine(location string) error {
+
+	suffix := "." + time.Now().UTC().Format("20060102T150405.000000000")
+	app.Log.Warn().Str("location", location).Str("quarantine", path.Join(quarantineDirectory, location+suffix)).Msg("Quarantined a document that cannot be read")
+
+	files := []string{location}
+	if strings.HasSuffix(location, dataExtension) {
+		files = append(files, metadataLocation(strings.TrimSuffix(location, dataExtension)))
+	}
+
+	for _, file := range files {
+
+		exists, err := store.fs.Exists(file)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			continue
+		}
+
+		quarantined := path.Join(quarantineDirectory, file+suffix)
+		err = store.fs.MkdirAll(path.Dir(quarantined))
+		if err != nil {
+			return err
+		}
+		err = store.fs.Rename(file, quarantined)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Put stores the content at the key, and returns the stored document.
+func (store *FileStore) Put(_ context.Context, key string, content interface{}) (*Document, error) {
+
+	location, err := encodeKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	bytes, err := encode(content)
+	if err != nil {
+		return nil, err
+	}
+
+	err = store.fs.WriteFile(location+jsonExtension, bytes)
+	if err != nil {
+		app.Log.Error(err, "Error occurred while storing content")
+		return nil, err
+	}
+
+	err = store.removeData(location)
+	if err != nil {
+		app.Log.Error(err, "Error occurred while removing data")
+		return nil, err
+	}
+
+	return &Document{Key: key, Content: content, Version: version(bytes), Modified: time.Now()}, nil
+}
+
+// PutData stores data that is not JSON at the key, with its metadata in a hidden file next to it,
+// and returns the stored document.
+func (store *FileStore) PutData(_ context.Context, key string, data []byte, metadata Metadata) (*Document, error) {
+
+	location, err := encodeKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	bytes, err := encode(metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	err = store.fs.WriteFile(metadataLocation(location), bytes)
+	if err != nil {
+		app.Log.Error(err, "Error occurred while storing metadata")
+		return nil, err
+	}
+
+	err = store.fs.WriteFile(location+dataExtension, data)
+	if err != nil {
+		app.Log.Error(err, "Error occurred while storing data")
+		return nil, err
+	}
+
+	_, err = store.removeFile(location + jsonExtension)
+	if err != nil {
+		app.Log.Error(err, "Error occurred while removing content")
+		return nil, err
+	}
+
+	document := dataDocument(key, data, metadata)
+	document.Modified = time.Now()
+
+	return document, nil
+}
+
+// Delete removes the document stored at the key, and indicates if it was present.
+func (store *FileStore) Delete(_ context.Context, key string) (bool, error) {
+
+	location, err := encodeKey(key)
+	if err != nil {
+		return false, err
+	}
+
+	return store.remove(location)
+}
+
+// remove removes the document stored at a location, in either of its files, and indicates if it was present.
+func (store *FileStore) remove(location string) (bool, error) {
+
+	removed, err := store.removeFile(location + jsonExtension)
+	if err != nil {
+		app.Log.Error(err, "Error occurred while removing content")
+		return false, err
+	}
+
+	removedData, err := store.removeFile(location + dataExtension)
+	if err != nil {
+		app.Log.Error(err, "Error occurred while removing data")
+		return false, err
+	}
+
+	err = store.removeData(location)
+	if err != nil {
+		app.Log.Error(err, "Error occurred while removing metadata")
+		return false, err
+	}
+
+	return removed || removedData, nil
+}
+
+// removeData removes the data stored at a location together with its metadata, when there is any.
+func (store *FileStore) removeData(location string) error {
+
+	_, err := store.removeFile(location + dataExtension)
+	if err != nil {
+		return err
+	}
+
+	_, err = store.removeFile(metadataLocation(location))
+	return err
+}
+
+// List returns the documents stored directly in the collection at the key, ordered by key.
+func (store *FileStore) List(ctx context.Context, key string) ([]*Document, error) {
+
+	var documents []*Document
+
+	location, err := encodeKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	exists, err := store.fs.DirExists(location)
+	if err != nil {
+		app.Log.Error(err, "Error occurred while checking if directory exists")
+		return nil, err
+	}
+
+	if !exists {
+		return documents, nil
+	}
+
+	files, err := store.fs.ReadDir(location)
+	if err != nil {
+		app.Log.Error(err, "Error occurred while retrieving files in directory")
+		return nil, err
+	}
+
+	listed := make(map[string]bool)
+
+	for _, fileInfo := range files {
+
+		encoded, isDocument := documentName(fileInfo)
+		if !isDocument || listed[encoded] {
+			continue
+		}
+		listed[encoded] = true
+
+		name, err := DecodeSegment(encoded)
+		if err != nil {
+			app.Log.Warn().Str("file", path.Join(location, fileInfo.Name())).Msg("Skipped a file with a name that is not encoded")
+			continue
+		}
+
+		document, exists, err := store.read(childKey(key, name), path.Join(location, encoded))
+		if err != nil {
+			app.Log.Error(err, "Error occurred while retrieving individual file in directory")
+			return nil, err
+		}
+
+		if exists {
+			documents = append(documents, document)
+		}
+	}
+
+	sort.Slice(documents, func(i, j int) bool {
+		return documents[i].Key < documents[j].Key
+	})
+
+	return documents, nil
+}
+
+// Collections returns the names of the collections directly below the key that hold documents, directly or in
+// collections below them, ordered by name. Directories that only hold empty directories are left out.
+func (store *FileStore) Collections(_ context.Context, key string) ([]string, error) {
+
+	location, err := encodeKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	exists, err := store.fs.DirExists(location)
+	if err != nil || !exists {
+		return nil, err
+	}
+
+	files, err := store.fs.ReadDir(location)
+	if err != nil {
+		app.Log.Error(err, "Error occurred while retrieving files in directory")
+		return nil, err
+	}
+
+	var names []string
+
+	for _, fileInfo := range files {
+
+		if !fileInfo.IsDir() || IsReserved(fileInfo.Name()) {
+			continue
+		}
+
+		name, err := DecodeSegment(fileInfo.Name())
+		if err != nil {
+			continue
+		}
+
+		found, err := store.containsDocuments(path.Join(location, fileInfo.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// containsDocuments indicates if a directory holds documents, directly or in the directories below it.
+func (store *FileStore) containsDocuments(location string) (bool, error) {
+
+	files, err := store.fs.ReadDir(location)
+	if err != nil {
+		return false, err
+	}
+
+	for _, fileInfo := range files {
+		if _, isDocument := documentName(fileInfo); isDocument {
+			return true, nil
+		}
+		if fileInfo.IsDir() && !strings.HasPrefix(fileInfo.Name(), hiddenPrefix) {
+			found, err := store.containsDocuments(path.Join(location, fileInfo.Name()))
+			if err != nil || found {
+				return found, err
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// documentName returns the encoded name of the document a file holds, and indicates if it holds one.
+func documentName(fileInfo os.FileInfo) (string, bool) {
+
+	name := fileInfo.Name()
+	if fileInfo.IsDir() || strings.HasPrefix(name, hiddenPrefix) {
+		return "", false
+	}
+
+	for _, extension := range []string{jsonExtension, dataExtension} {
+		if strings.HasSuffix(name, extension) {
+			return strings.TrimSuffix(name, extension), true
+		}
+	}
+
+	return "", false
+}
+
+// Replace replaces all documents stored directly in the collection at the key with the contents.
+// The new documents are staged first and the files of the current documents are moved aside until all of them are in
+// place, so the collection is restored when any of them cannot be written.
+func (store *FileStore) Replace(ctx context.Context, key string, contents map[string]interface{}) ([]*Document, error) {
+
+	location, err := encodeKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	names := sortedNames(contents)
+	documents := make([]*Document, 0, len(names))
+	locations := make([]string, 0, len(names))
+	staged := make([]string, 0, len(names))
+
+	removeStaged := func() {
+		for _, stagedLocation := range staged {
+			store.fs.Remove(stagedLocation)
+		}
+	}
+
+	for _, name := range names {
+
+		err := CheckSegment(name)
+		if err != nil {
+			removeStaged()
+			return nil, err
+		}
+
+		bytes, err := encode(contents[name])
+		if err != nil {
+			removeStaged()
+			return nil, err
+		}
+
+		stagedLocation := path.Join(location, hiddenPrefix+EncodeSegment(name)+jsonExtension+stagedSuffix)
+		err = store.fs.WriteFile(stagedLocation, bytes)
+		if err != nil {
+			app.Log.Error(err, "Error occurred while staging content")
+			removeStaged()
+			return nil, err
+		}
+
+		staged = append(staged, stagedLocation)
+		locations = append(locations, path.Join(location, EncodeSegment(name)))
+		documents = append(documents, &Document{Key: childKey(key, name), Content: contents[name], Version: version(bytes), Modified: time.Now()})
+	}
+
+	existing, err := store.List(ctx, key)
+	if err != nil {
+		removeStaged()
+		return nil, err
+	}
+
+	var backups, placed []string
+
+	rollback := func() {
+		for _, placedLocation := range placed {
+			store.fs.Remove(placedLocation)
+		}
+		for _, backup := range backups {
+			store.fs.Rename(backup, backupOriginal(backup))
+		}
+		removeStaged()
+	}
+
+	for _, document := range existing {
+		documentLocation := path.Join(location, EncodeSegment(path.Base(document.Key)))
+		for _, file := range []string{documentLocation + jsonExtension, documentLocation + dataExtension, metadataLocation(documentLocation)} {
+			exists, err := store.fs.Exists(file)
+			if err == nil && exists {
+				err = store.fs.Rename(file, backupLocation(file))
+			}
+			if err != nil {
+				app.Log.Error(err, "Error occurred while moving current content aside")
+				rollback()
+				return nil, err
+			}
+			if exists {
+				backups = append(backups, backupLocation(file))
+			}
+		}
+	}
+
+	for index, stagedLocation := range staged {
+		err = store.fs.Rename(stagedLocation, locations[index]+jsonExtension)
+		if err != nil {
+			app.Log.Error(err, "Error occurred while storing staged content")
+			rollback()
+			return nil, err
+		}
+		placed = append(placed, locations[index]+jsonExtension)
+	}
+
+	for _, backup := range backups {
+		err = store.fs.Remove(backup)
+		if err != nil {
+			// The documents are replaced, a remaining backup is removed when the store is opened again
+			app.Log.Error(err, "Error occurred while removing replaced content")
+		}
+	}
+
+	return documents, nil
+}
+
+// The suffixes of the hidden files that Replace writes next to the documents of a collection.
+const (
+	stagedSuffix = ".staged"
+	backupSuffix = ".backup"
+)
+
+// backupLocation returns the location a file is moved aside to while its collection is replaced.
+func backupLocation(location string) string {
+	return path.Join(path.Dir(location), hiddenPrefix+path.Base(location)+backupSuffix)
+}
+
+// backupOriginal returns the location of the file that was moved aside to a backup location.
+func backupOriginal(backup string) string {
+	name := strings.TrimSuffix(strings.TrimPrefix(path.Base(backup), hiddenPrefix), backupSuffix)
+	return path.Join(path.Dir(backup), name)
+}
@@ -0,0 +1,382 @@
+/*
+Copyright © 2020 Arnoud Kleinloog
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package storage
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sync"
+	"time"
+)
+
+// History is implemented by stores that keep the history of their documents.
+type History interface {
+
+	// History returns the revisions of the document at the key, oldest first.
+	History(ctx context.Context, key string) ([]*Revision, error)
+
+	// Revision returns a revision of the document at the key, together with the document as it was stored in it,
+	// and indicates if the revision exists. The document is nil when the revision deleted it.
+	Revision(ctx context.Context, key string, number int) (*Revision, *Document, bool, error)
+
+	// Restore stores the document at the key as it was in a revision, and indicates if the revision exists.
+	// The document is nil when the revision deleted it, in which case the document is deleted again.
+	Restore(ctx context.Context, key string, number int) (*Document, bool, error)
+}
+
+// Revision describes a change to a document.
+type Revision struct {
+	Number       int       `json:"version"`
+	Timestamp    time.Time `json:"timestamp"`
+	Operation    string    `json:"operation"`
+	Version      string    `json:"etag,omitempty"`
+	Deleted      bool      `json:"deleted,omitempty"`
+	RestoredFrom int       `json:"restoredFrom,omitempty"`
+	Request      *Change   `json:"request,omitempty"`
+}
+
+// The operations that are recorded in the history.
+const (
+	OperationPut     = "put"
+	OperationDelete  = "delete"
+	OperationRestore = "restore"
+)
+
+// Change describes the request that changes documents, it is recorded in their history.
+type Change struct {
+	Method    string `json:"method,omitempty"`
+	Path      string `json:"path,omitempty"`
+	RemoteIP  string `json:"remoteIp,omitempty"`
+	UserAgent string `json:"userAgent,omitempty"`
+}
+
+type changeKey struct{}
+
+// WithChange returns a context that carries the change, so stores can record it.
+func WithChange(ctx context.Context, change Change) context.Context {
+	return context.WithValue(ctx, changeKey{}, change)
+}
+
+// changeFrom returns the change carried by the context, or nil when there is none.
+func changeFrom(ctx context.Context) *Change {
+	if change, present := ctx.Value(changeKey{}).(Change); present {
+		return &change
+	}
+	return nil
+}
+
+// Retention limits how much history is kept. Zero values impose no limit,
+// and the most recent revision of a document is always kept.
+type Retention struct {
+	Count int
+	Age   time.Duration
+}
+
+// historyPrefix is the reserved collection that revisions are kept in.
+const historyPrefix = ReservedPrefix + "history"
+
+// HistoryStore keeps the history of the documents in a store, storing revisions in that store as well.
+type HistoryStore struct {
+	Store
+	retention Retention
+	mutex     sync.Mutex
+	now       func() time.Time
+}
+
+// NewHistoryStore returns a store that keeps the history of the documents in the store.
+func NewHistoryStore(store Store, retention Retention) *HistoryStore {
+	return &HistoryStore{Store: store, retention: retention, now: time.Now}
+}
+
+// revisionRecord is a revision as it is stored, together with the document it stored.
+type revisionRecord struct {
+	Revision
+	Content  interface{} `json:"content"`
+	Data     []byte      `json:"data,omitempty"`
+	Metadata *Metadata   `json:"metadata,omitempty"`
+}
+
+// historyKey returns the key of the collection that holds the revisions of the document at the key.
+func historyKey(key string) string {
+	return path.Join(historyPrefix, key)
+}
+
+// revisionKey returns the key of a revision, numbers are padded so revisions are listed in order.
+func revisionKey(key string, number int) string {
+	return childKey(historyKey(key), fmt.Sprintf("%010d", number))
+}
+
+// Put stores the content at the key, and records it in the history.
+func (store *HistoryStore) Put(ctx context.Context, key string, content interface{}) (*Document, error) {
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	document, err := store.Store.Put(ctx, key, content)
+	if err != nil {
+		return nil, err
+	}
+
+	return document, store.record(ctx, key, OperationPut, document, 0)
+}
+
+// PutData stores data at the key, and records it in the history.
+func (store *HistoryStore) PutData(ctx context.Context, key string, data []byte, metadata Metadata) (*Document, error) {
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	document, err := store.Store.PutData(ctx, key, data, metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	return document, store.record(ctx, key, OperationPut, document, 0)
+}
+
+// Delete removes the document stored at the key, and records the deletion in the history when it was present.
+func (store *HistoryStore) Delete(ctx context.Context, key string) (bool, error) {
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	wasPresent, err := store.Store.Delete(ctx, key)
+	if err != nil || !wasPresent {
+		return wasPresent, err
+	}
+
+	return true, store.record(ctx, key, OperationDelete, nil, 0)
+}
+
+// Replace replaces all documents in the collection at the key, and records the stored and deleted documents.
+func (store *HistoryStore) Replace(ctx context.Context, key string, contents map[string]interface{}) ([]*Document, error) {
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	existing, err := store.Store.List(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	documents, err := store.Store.Replace(ctx, key, contents)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, document := range existing {
+		if _, keep := contents[path.Base(document.Key)]; !keep {
+			err = store.record(ctx, document.Key, OperationDelete, nil, 0)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, document := range documents {
+		err = store.record(ctx, document.Key, OperationPut, document, 0)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return documents, nil
+}
+
+// History returns the revisions of the document at the key, oldest first.
+func (store *HistoryStore) History(ctx context.Context, key string) ([]*Revision, error) {
+
+	records, err := store.records(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	revisions := make([]*Revision, 0, len(records))
+	for _, record := range records {
+		revision := record.Revision
+		revisions = append(revisions, &revision)
+	}
+
+	return revisions, nil
+}
+
+// Revision returns a revision of the document at the key, with the document as it was stored in it.
+func (store *HistoryStore) Revision(ctx context.Context, key string, number int) (*Revision, *Document, bool, error) {
+
+	record, exists, err := store.revisionRecord(ctx, key, number)
+	if err != nil || !exists {
+		return nil, nil, exists, err
+	}
+
+	return &record.Revision, record.document(key), true, nil
+}
+
+// Restore stores the document at the key as it was in a revision, and records the restore in the history.
+func (store *HistoryStore) Restore(ctx context.Context, key string, number int) (*Document, bool, error) {
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	record, exists, err := store.revisionRecord(ctx, key, number)
+	if err != nil || !exists {
+		return nil, exists, err
+	}
+
+	restored := record.document(key)
+
+	var document *Document
+	switch {
+	case restored == nil:
+		_, err = store.Store.Delete(ctx, key)
+	case restored.IsJSON():
+		document, err = store.Store.Put(ctx, key, restored.Content)
+	default:
+		document, err = store.Store.PutData(ctx, key, restored.Data, *restored.Metadata)
+	}
+	if err != nil {
+		return nil, true, err
+	}
+
+	return document, true, store.record(ctx, key, OperationRestore, document, number)
+}
+
+// document returns the document that was stored in the revision, or nil when it was deleted.
+func (record *revisionRecord) document(key string) *Document {
+
+	if record.Deleted {
+		return nil
+	}
+
+	return &Document{Key: key, Content: record.Content, Data: record.Data, Metadata: record.Metadata, Version: record.Version, Modified: record.Timestamp}
+}
+
+// revisionRecord returns the stored revision of the document at the key, and indicates if it exists.
+func (store *HistoryStore) revisionRecord(ctx context.Context, key string, number int) (*revisionRecord, bool, error) {
+
+	stored, exists, err := store.Store.Get(ctx, revisionKey(key, number))
+	if err != nil || !exists {
+		return nil, exists, err
+	}
+
+	record, err := toRevisionRecord(stored)
+	if err != nil {
+		return nil, true, err
+	}
+
+	return record, true, nil
+}
+
+// records returns the stored revisions of the document at the key, oldest first.
+func (store *HistoryStore) records(ctx context.Context, key string) ([]*revisionRecord, error) {
+
+	stored, err := store.Store.List(ctx, historyKey(key))
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]*revisionRecord, 0, len(stored))
+	for _, document := range stored {
+		record, err := toRevisionRecord(document)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// toRevisionRecord converts a stored document into the revision it holds.
+func toRevisionRecord(document *Document) (*revisionRecord, error) {
+
+	var record revisionRecord
+	err := Convert(document.Content, &record)
+	if err != nil {
+		return nil, fmt.Errorf("invalid revision `%s`: %w", document.Key, err)
+	}
+
+	return &record, nil
+}
+
+// record adds a revision to the history of the document at the key, and removes revisions that are no longer retained.
+// The document is nil when it was deleted.
+func (store *HistoryStore) record(ctx context.Context, key string, operation string, document *Document, restoredFrom int) error {
+
+	records, err := store.records(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	number := 1
+	if len(records) > 0 {
+		number = records[len(records)-1].Number + 1
+	}
+
+	record := revisionRecord{Revision: Revision{
+		Number:       number,
+		Timestamp:    store.now().UTC(),
+		Operation:    operation,
+		RestoredFrom: restoredFrom,
+		Request:      changeFrom(ctx),
+	}}
+
+	if document == nil {
+		record.Deleted = true
+	} else {
+		record.Version = document.Version
+		record.Content = document.Content
+		record.Data = document.Data
+		record.Metadata = document.Metadata
+	}
+
+	var content interface{}
+	err = Convert(record, &content)
+	if err != nil {
+		return err
+	}
+
+	_, err = store.Store.Put(ctx, revisionKey(key, number), content)
+	if err != nil {
+		return err
+	}
+
+	return store.prune(ctx, key, append(records, &record))
+}
+
+// prune removes the revisions that are beyond the retained count or age, except for the most recent one.
+func (store *HistoryStore) prune(ctx context.Context, key string, records []*revisionRecord) error {
+
+	cutoff := time.Time{}
+	if store.retention.Age > 0 {
+		cutoff = store.now().Add(-store.retention.Age)
+	}
+
+	for index, record := range records[:len(records)-1] {
+		remaining := len(records) - index
+		tooMany := store.retention.Count > 0 && remaining > store.retention.Count
+		tooOld := !cutoff.IsZero() && record.Timestamp.Before(cutoff)
+		if !tooMany && !tooOld {
+			continue
+		}
+		_, err := store.Store.Delete(ctx, revisionKey(key, record.Number))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
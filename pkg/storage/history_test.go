@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestHistory(t *testing.T) {
+
+	directory, err := ioutil.TempDir("", "lazy-rest")
+	if !assert.NoError(t, err, "Error occurred while creating test directory") {
+		return
+	}
+	defer os.RemoveAll(directory)
+
+	fileStore, err := NewFileStore(directory)
+	if !assert.NoError(t, err, "Error occurred while creating file store") {
+		return
+	}
+
+	for _, backend := range []Store{fileStore, NewMemoryStore()} {
+
+		store := NewHistoryStore(backend, Retention{})
+		ctx := WithChange(context.Background(), Change{Method: "PUT", Path: "/items/1"})
+
+		_, err := store.Put(ctx, "items/1", map[string]interface{}{"id": "1", "name": "First"})
+		assert.NoError(t, err, "Error occurred while storing content")
+		_, err = store.Put(ctx, "items/1", map[string]interface{}{"id": "1", "name": "Second"})
+		assert.NoError(t, err, "Error occurred while storing content")
+		_, err = store.Delete(ctx, "items/1")
+		assert.NoError(t, err, "Error occurred while removing content")
+
+		revisions, err := store.History(ctx, "items/1")
+		if assert.NoError(t, err, "Error occurred while retrieving history") && assert.Len(t, revisions, 3) {
+			assert.Equal(t, 1, revisions[0].Number)
+			assert.Equal(t, OperationPut, revisions[0].Operation)
+			assert.Equal(t, &Change{Method: "PUT", Path: "/items/1"}, revisions[0].Request)
+			assert.Equal(t, OperationDelete, revisions[2].Operation)
+			assert.True(t, revisions[2].Deleted, "Deletion should be marked")
+		}
+
+		documents, err := store.List(ctx, "items")
+		if assert.NoError(t, err, "Error occurred while listing content") {
+			assert.Empty(t, documents, "History should not be listed in the collection")
+		}
+
+		_, document, exists, err := store.Revision(ctx, "items/1", 1)
+		if assert.NoError(t, err, "Error occurred while retrieving revision") && assert.True(t, exists) {
+			assert.Equal(t, map[string]interface{}{"id": "1", "name": "First"}, document.Content)
+		}
+
+		restored, exists, err := store.Restore(ctx, "items/1", 1)
+		if assert.NoError(t, err, "Error occurred while restoring revision") && assert.True(t, exists) {
+			assert.Equal(t, revisions[0].Version, restored.Version, "Restored document should have its original version")
+		}
+
+		document, exists, err = store.Get(ctx, "items/1")
+		if assert.NoError(t, err, "Error occurred while retrieving content") && assert.True(t, exists) {
+			assert.Equal(t, map[string]interface{}{"id": "1", "name": "First"}, document.Content)
+		}
+
+		revisions, _ = store.History(ctx, "items/1")
+		if assert.Len(t, revisions, 4) {
+			assert.Equal(t, OperationRestore, revisions[3].Operation)
+			assert.Equal(t, 1, revisions[3].RestoredFrom)
+		}
+	}
+}
+
+func TestHistoryRetention(t *testing.T) {
+
+	ctx := context.Background()
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	store := NewHistoryStore(NewMemoryStore(), Retention{Count: 3, Age: time.Hour})
+	store.now = func() time.Time { return now }
+
+	for version := 1; version <= 5; version++ {
+		_, err := store.Put(ctx, "items/1", map[string]interface{}{"version": float64(version)})
+		assert.NoError(t, err, "Error occurred while storing content")
+	}
+
+	revisions, err := store.History(ctx, "items/1")
+	if assert.NoError(t, err, "Error occurred while retrieving history") && assert.Len(t, revisions, 3) {
+		assert.Equal(t, 3, revisions[0].Number, "Oldest revisions should be removed beyond the count")
+	}
+
+	now = now.Add(2 * time.Hour)
+	_, err = store.Put(ctx, "items/1", map[string]interface{}{"version": 6.0})
+	assert.NoError(t, err, "Error occurred while storing content")
+
+	revisions, err = store.History(ctx, "items/1")
+	if assert.NoError(t, err, "Error occurred while retrieving history") && assert.Len(t, revisions, 1) {
+		assert.Equal(t, 6, revisions[0].Number, "Revisions beyond the age should be removed, except the most recent")
+	}
+}
+
+func TestHistoryOfReplacedCollection(t *testing.T) {
+
+	ctx := context.Background()
+	store := NewHistoryStore(NewMemoryStore(), Retention{})
+
+	_, err := store.Put(ctx, "items/1", map[string]interface{}{"id": "1"})
+	assert.NoError(t, err, "Error occurred while storing content")
+
+	_, err = store.Replace(ctx, "items", map[string]interface{}{"2": map[string]interface{}{"id": "2"}})
+	assert.NoError(t, err, "Error occurred while replacing collection")
+
+	revisions, _ := store.History(ctx, "items/1")
+	if assert.Len(t, revisions, 2) {
+		assert.Equal(t, OperationDelete, revisions[1].Operation)
+	}
+
+	revisions, _ = store.History(ctx, "items/2")
+	assert.Len(t, revisions, 1)
+}
@@ -0,0 +1,206 @@
+/*
+Copyright © 2020 Arnoud Kleinloog
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrInvalidKey indicates that a key can not be used to store a document, like one that tries to escape its collection.
+var ErrInvalidKey = errors.New("invalid key")
+
+// KeyError describes why a key can not be used.
+type KeyError struct {
+	Key    string
+	Reason string
+}
+
+func (err *KeyError) Error() string {
+	return fmt.Sprintf("%v `%s`, %s", ErrInvalidKey, err.Key, err.Reason)
+}
+
+// Unwrap returns ErrInvalidKey, so key errors can be recognized with errors.Is.
+func (err *KeyError) Unwrap() error {
+	return ErrInvalidKey
+}
+
+// maxSegmentLength is the maximum length of an encoded segment, which is the limit of most file systems.
+const maxSegmentLength = 255
+
+// reservedNames are names that Windows reserves for devices, also when followed by an extension.
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// CheckKey checks that a key can be used to store a document. Keys are slash separated segments, which must be valid.
+// The empty key is the root collection.
+func CheckKey(key string) error {
+
+	if key == "" {
+		return nil
+	}
+
+	for _, segment := range strings.Split(key, "/") {
+		reason := checkSegment(segment)
+		if reason != "" {
+			return &KeyError{Key: key, Reason: reason}
+		}
+	}
+
+	return nil
+}
+
+// CheckSegment checks that a name can be used as a single segment of a key, like the id of a document.
+func CheckSegment(name string) error {
+
+	reason := checkSegment(name)
+	if reason != "" {
+		return &KeyError{Key: name, Reason: reason}
+	}
+
+	return nil
+}
+
+// checkSegment returns the reason a segment can not be used, or an empty string when it can.
+func checkSegment(segment string) string {
+
+	switch {
+	case segment == "":
+		return "it has an empty segment"
+	case segment == "." || segment == "..":
+		return "it refers to another collection"
+	case strings.Contains(segment, "/"):
+		return "it contains a slash"
+	case !utf8.ValidString(segment):
+		return "it is not valid UTF-8"
+	case strings.IndexFunc(segment, isControl) >= 0:
+		return "it contains control characters"
+	case len(EncodeSegment(segment)) > maxSegmentLength:
+		return "it is too long"
+	}
+
+	return ""
+}
+
+// isControl indicates if a character is a control character, like NUL or a new line.
+func isControl(character rune) bool {
+	return character < 0x20 || character == 0x7f
+}
+
+// EncodeSegment encodes a segment of a key into a name that can be used as file name on any file system.
+// Characters that are not allowed or have a special meaning, like backslashes, colons and percent signs,
+// are percent encoded, as are names that Windows reserves for devices and trailing dots and spaces.
+// The dot of a trailing .json or .data is encoded as well, as these extensions mark the files of documents.
+// Leading dots are kept, as these mark the files that the store uses itself.
+func EncodeSegment(segment string) string {
+
+	var encoded strings.Builder
+
+	extension := -1
+	if hasDocumentExtension(segment) {
+		extension = len(segment) - len(jsonExtension)
+	}
+
+	for index := 0; index < len(segment); index++ {
+		character := segment[index]
+		trailing := index == len(segment)-1 && (character == '.' || character == ' ')
+		if trailing || index == extension || needsEncoding(character) || (index == 0 && isReservedName(segment)) {
+			fmt.Fprintf(&encoded, "%%%02X", character)
+		} else {
+			encoded.WriteByte(character)
+		}
+	}
+
+	return encoded.String()
+}
+
+// hasDocumentExtension indicates if a segment ends with one of the extensions of the files of documents,
+// in any case, as not every file system is case sensitive.
+func hasDocumentExtension(segment string) bool {
+	for _, extension := range []string{jsonExtension, dataExtension} {
+		if len(segment) >= len(extension) && strings.EqualFold(segment[len(segment)-len(extension):], extension) {
+			return true
+		}
+	}
+	return false
+}
+
+// needsEncoding indicates if a character is not allowed in file names, or has a special meaning in them.
+func needsEncoding(character byte) bool {
+	return character < 0x20 || character == 0x7f || strings.IndexByte(`%/\<>:"|?*`, character) >= 0
+}
+
+// isReservedName indicates if Windows reserves a name for a device, like CON or com1.txt.
+func isReservedName(segment string) bool {
+	name := strings.ToUpper(strings.SplitN(segment, ".", 2)[0])
+	return reservedNames[strings.TrimRight(name, " ")]
+}
+
+// DecodeSegment decodes a file name into the segment of a key it was encoded from.
+func DecodeSegment(name string) (string, error) {
+
+	var decoded strings.Builder
+
+	for index := 0; index < len(name); index++ {
+		if name[index] != '%' {
+			decoded.WriteByte(name[index])
+			continue
+		}
+		if index+2 >= len(name) || !isHex(name[index+1]) || !isHex(name[index+2]) {
+			return "", fmt.Errorf("invalid encoding in file name `%s`", name)
+		}
+		decoded.WriteByte(unhex(name[index+1])<<4 | unhex(name[index+2]))
+		index += 2
+	}
+
+	return decoded.String(), nil
+}
+
+func isHex(character byte) bool {
+	return ('0' <= character && character <= '9') || ('A' <= character && character <= 'F') || ('a' <= character && character <= 'f')
+}
+
+func unhex(character byte) byte {
+	switch {
+	case character >= 'a':
+		return character - 'a' + 10
+	case character >= 'A':
+		return character - 'A' + 10
+	default:
+		return character - '0'
+	}
+}
+
+// encodeKey checks a key and encodes its segments into the location of its file.
+func encodeKey(key string) (string, error) {
+
+	err := CheckKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	segments := strings.Split(key, "/")
+	for index, segment := range segments {
+		segments[index] = EncodeSegment(segment)
+	}
+
+	return strings.Join(segments, "/"), nil
+}
@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+var hostileSegments = []string{
+	"CON", "con.txt", "Lpt1", "nul ", "a:b", `a\b`, `..\..\windows`, "100%", "%2E%2E", "trailing.", "trailing ",
+	"a*b?c", `<"quoted">`, "pipe|", "名前", "emoji 🎉", ".hidden", "...x", "-", "~",
+	"notes.json", "logo.DATA",
+}
+
+func TestEncodeSegment(t *testing.T) {
+
+	for _, segment := range hostileSegments {
+
+		encoded := EncodeSegment(segment)
+		assert.False(t, strings.ContainsAny(encoded, `/\<>:"|?*`), "Encoded `%s` should be a valid file name, was `%s`", segment, encoded)
+		assert.False(t, isReservedName(encoded), "Encoded `%s` should not be reserved, was `%s`", segment, encoded)
+		assert.False(t, strings.HasSuffix(encoded, ".") || strings.HasSuffix(encoded, " "), "Encoded `%s` should not end with a dot or space", segment)
+
+		decoded, err := DecodeSegment(encoded)
+		if assert.NoError(t, err) {
+			assert.Equal(t, segment, decoded, "Segments should be decoded into what was encoded")
+		}
+	}
+
+	assert.Equal(t, "items", EncodeSegment("items"), "Regular names should be kept as they are")
+	assert.Equal(t, "%43ON", EncodeSegment("CON"))
+	assert.Equal(t, "notes%2Ejson", EncodeSegment("notes.json"), "Names should not end with the extension of a document")
+	assert.Equal(t, "notes.txt", EncodeSegment("notes.txt"))
+
+	_, err := DecodeSegment("100%")
+	assert.Error(t, err, "Incomplete encodings should not be decoded")
+	_, err = DecodeSegment("%zz")
+	assert.Error(t, err, "Invalid encodings should not be decoded")
+}
+
+func TestCheckKey(t *testing.T) {
+
+	valid := []string{"", "items", "items/1", ".history/items/1", "items/CON", "items/a:b", "items/名前"}
+	for _, key := range valid {
+		assert.NoError(t, CheckKey(key), "Key `%s` should be valid", key)
+	}
+
+	invalid := []string{
+		"..", "../x", "items/../../etc/passwd", "items/./1", "items//1", "/items", "items/",
+		"items/a\x00b", "items/new\nline", "items/\xff", "items/" + strings.Repeat("x", 256),
+	}
+	for _, key := range invalid {
+		err := CheckKey(key)
+		assert.True(t, errors.Is(err, ErrInvalidKey), "Key `%q` should be invalid", key)
+	}
+
+	assert.Error(t, CheckSegment("a/b"), "Segments should not contain slashes")
+	assert.NoError(t, CheckSegment("a:b"))
+}
+
+func TestFileStoreEncodesKeys(t *testing.T) {
+
+	directory, err := ioutil.TempDir("", "lazy-rest")
+	if !assert.NoError(t, err, "Error occurred while creating test directory") {
+		return
+	}
+	defer os.RemoveAll(directory)
+
+	store, err := NewFileStore(path.Join(directory, "data"))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	ctx := context.Background()
+
+	stored := 0
+	for _, segment := range hostileSegments {
+		if strings.HasPrefix(segment, ".") {
+			// Names starting with a dot are hidden from collections
+			continue
+		}
+		stored++
+		_, err := store.Put(ctx, "items/"+segment, map[string]interface{}{"id": segment})
+		assert.NoError(t, err, "Document `%s` should be stored", segment)
+	}
+
+	documents, err := store.List(ctx, "items")
+	if assert.NoError(t, err) {
+		assert.Len(t, documents, stored)
+		for _, document := range documents {
+			assert.Equal(t, "items/"+document.Content.(map[string]interface{})["id"].(string), document.Key, "Keys should be decoded")
+		}
+	}
+
+	_, err = store.Put(ctx, "../escaped", map[string]interface{}{"id": "escaped"})
+	assert.True(t, errors.Is(err, ErrInvalidKey), "Keys should not escape the directory")
+	_, err = os.Stat(path.Join(directory, "escaped"))
+	assert.True(t, os.IsNotExist(err), "Nothing should be written outside of the directory")
+
+	_, _, err = store.Get(ctx, "items/../../escaped")
+	assert.True(t, errors.Is(err, ErrInvalidKey))
+	_, err = store.Delete(ctx, "..")
+	assert.True(t, errors.Is(err, ErrInvalidKey))
+	_, err = store.Replace(ctx, "items", map[string]interface{}{"..": map[string]interface{}{}})
+	assert.True(t, errors.Is(err, ErrInvalidKey))
+}
@@ -0,0 +1,220 @@
+/*
+Copyright © 2020 Arnoud Kleinloog
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package storage
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps documents in memory, they are lost when the process ends.
+type MemoryStore struct {
+	mutex     sync.RWMutex
+	documents map[string]*memoryEntry
+}
+
+// memoryEntry holds the stored bytes of a document, the metadata when it is not JSON, and when it was stored.
+type memoryEntry struct {
+	bytes    []byte
+	metadata *Metadata
+	modified time.Time
+}
+
+// NewMemoryStore returns an empty in memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{documents: make(map[string]*memoryEntry)}
+}
+
+// Get returns the document stored at the key, and indicates if it exists.
+func (store *MemoryStore) Get(_ context.Context, key string) (*Document, bool, error) {
+
+	store.mutex.RLock()
+	entry, exists := store.documents[key]
+	store.mutex.RUnlock()
+
+	if !exists {
+		return nil, false, nil
+	}
+
+	if entry.metadata != nil {
+		document := dataDocument(key, entry.bytes, *entry.metadata)
+		document.Modified = entry.modified
+		return document, true, nil
+	}
+
+	document, err := decode(key, entry.bytes)
+	if err != nil {
+		return nil, true, err
+	}
+	document.Modified = entry.modified
+
+	return document, true, nil
+}
+
+// Put stores the content at the key, and returns the stored document.
+func (store *MemoryStore) Put(_ context.Context, key string, content interface{}) (*Document, error) {
+
+	bytes, err := encode(content)
+	if err != nil {
+		return nil, err
+	}
+
+	modified := time.Now()
+
+	store.mutex.Lock()
+	store.documents[key] = &memoryEntry{bytes: bytes, modified: modified}
+	store.mutex.Unlock()
+
+	return &Document{Key: key, Content: content, Version: version(bytes), Modified: modified}, nil
+}
+
+// PutData stores data that is not JSON at the key, together with its metadata, and returns the stored document.
+func (store *MemoryStore) PutData(_ context.Context, key string, data []byte, metadata Metadata) (*Document, error) {
+
+	stored := make([]byte, len(data))
+	copy(stored, data)
+
+	modified := time.Now()
+
+	store.mutex.Lock()
+	store.documents[key] = &memoryEntry{bytes: stored, metadata: &metadata, modified: modified}
+	store.mutex.Unlock()
+
+	document := dataDocument(key, stored, metadata)
+	document.Modified = modified
+
+	return document, nil
+}
+
+// Delete removes the document stored at the key, and indicates if it was present.
+func (store *MemoryStore) Delete(_ context.Context, key string) (bool, error) {
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	_, exists := store.documents[key]
+	delete(store.documents, key)
+
+	return exists, nil
+}
+
+// Replace replaces all documents stored directly in the collection at the key with the contents.
+func (store *MemoryStore) Replace(_ context.Context, key string, contents map[string]interface{}) ([]*Document, error) {
+
+	names := sortedNames(contents)
+	encoded := make(map[string][]byte, len(contents))
+
+	for _, name := range names {
+		bytes, err := encode(contents[name])
+		if err != nil {
+			return nil, err
+		}
+		encoded[childKey(key, name)] = bytes
+	}
+
+	modified := time.Now()
+
+	store.mutex.Lock()
+	for documentKey := range store.documents {
+		if isChild(key, documentKey) {
+			delete(store.documents, documentKey)
+		}
+	}
+	for documentKey, bytes := range encoded {
+		store.documents[documentKey] = &memoryEntry{bytes: bytes, modified: modified}
+	}
+	store.mutex.Unlock()
+
+	documents := make([]*Document, 0, len(names))
+	for _, name := range names {
+		documentKey := childKey(key, name)
+		documents = append(documents, &Document{Key: documentKey, Content: contents[name], Version: version(encoded[documentKey]), Modified: modified})
+	}
+
+	return documents, nil
+}
+
+// isChild indicates if the document key is directly in the collection at the key.
+func isChild(key string, documentKey string) bool {
+
+	prefix := key + "/"
+	if key == "" {
+		prefix = ""
+	}
+
+	return strings.HasPrefix(documentKey, prefix) && !strings.Contains(documentKey[len(prefix):], "/")
+}
+
+// List returns the documents stored directly in the collection at the key, ordered by key.
+func (store *MemoryStore) List(ctx context.Context, key string) ([]*Document, error) {
+
+	store.mutex.RLock()
+	var keys []string
+	for documentKey := range store.documents {
+		if isChild(key, documentKey) {
+			keys = append(keys, documentKey)
+		}
+	}
+	store.mutex.RUnlock()
+
+	sort.Strings(keys)
+
+	documents := make([]*Document, 0, len(keys))
+	for _, documentKey := range keys {
+		document, exists, err := store.Get(ctx, documentKey)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			documents = append(documents, document)
+		}
+	}
+
+	return documents, nil
+}
+
+// Collections returns the names of the collections directly below the key that hold documents, ordered by name.
+func (store *MemoryStore) Collections(_ context.Context, key string) ([]string, error) {
+
+	prefix := key + "/"
+	if key == "" {
+		prefix = ""
+	}
+
+	store.mutex.RLock()
+	found := make(map[string]bool)
+	for documentKey := range store.documents {
+		if !strings.HasPrefix(documentKey, prefix) {
+			continue
+		}
+		segments := strings.SplitN(documentKey[len(prefix):], "/", 2)
+		if len(segments) == 2 && !IsReserved(segments[0]) {
+			found[segments[0]] = true
+		}
+	}
+	store.mutex.RUnlock()
+
+	names := make([]string, 0, len(found))
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
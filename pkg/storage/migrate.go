@@ -0,0 +1,190 @@
+/*
+Copyright © 2020 Arnoud Kleinloog
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/akleinloog/lazy-rest/pkg/filesystem"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Migration is a file or directory that is renamed to convert a data directory to the current layout.
+type Migration struct {
+	From string
+	To   string
+}
+
+// MigrateFileStore converts a data directory from the layout of an older version, where documents were stored in files
+// without extension, to the current layout, and returns the files and directories that were renamed.
+// With dryRun, nothing is renamed. Nothing is renamed either when any of the new names is already taken.
+func MigrateFileStore(directory string, dryRun bool) ([]Migration, error) {
+
+	info, err := os.Stat(directory)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open data directory `%s`: %w", directory, err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("data directory `%s` is not a directory", directory)
+	}
+
+	fs := filesystem.NewOsFs(directory)
+
+	migrations, err := planMigrations(fs)
+	if err != nil {
+		return nil, err
+	}
+
+	if dryRun {
+		return migrations, nil
+	}
+
+	for _, migration := range migrations {
+		err = fs.Rename(migration.From, migration.To)
+		if err != nil {
+			return nil, fmt.Errorf("unable to rename `%s` to `%s`: %w", migration.From, migration.To, err)
+		}
+	}
+
+	return migrations, nil
+}
+
+// planMigrations returns the renames that convert the files in the file system to the current layout. Files are renamed
+// before the directories they are in, and directories are renamed deepest first, so every rename finds its source.
+func planMigrations(fs filesystem.Fs) ([]Migration, error) {
+
+	var files, directories []Migration
+
+	err := fs.Walk(".", func(location string, fileInfo os.FileInfo, err error) error {
+
+		if err != nil {
+			return err
+		}
+
+		name := fileInfo.Name()
+		if location == "." {
+			return nil
+		}
+
+		// Hidden directories, like the history, hold documents as well, hidden files are not documents
+		if fileInfo.IsDir() && name == quarantineDirectory {
+			return filepath.SkipDir
+		}
+		if !fileInfo.IsDir() && strings.HasPrefix(name, hiddenPrefix) {
+			return nil
+		}
+
+		base := migratedName(name)
+		dir := path.Dir(location)
+
+		if fileInfo.IsDir() {
+			if base != name {
+				directories = append(directories, Migration{From: location, To: path.Join(dir, base)})
+			}
+			return nil
+		}
+
+		legacy, err := isLegacyDocument(fs, location, fileInfo)
+		if err != nil || !legacy {
+			return err
+		}
+
+		metadata := metadataLocation(location)
+		hasMetadata, err := fs.Exists(metadata)
+		if err != nil {
+			return err
+		}
+
+		if !hasMetadata {
+			files = append(files, Migration{From: location, To: path.Join(dir, base+jsonExtension)})
+			return nil
+		}
+
+		files = append(files, Migration{From: location, To: path.Join(dir, base+dataExtension)})
+		if base != name {
+			files = append(files, Migration{From: metadata, To: metadataLocation(path.Join(dir, base))})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, migration := range files {
+		exists, err := fs.Exists(migration.To)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			return nil, fmt.Errorf("unable to rename `%s`, `%s` already exists", migration.From, migration.To)
+		}
+	}
+
+	// Directories are walked parents first
+	for index := len(directories) - 1; index >= 0; index-- {
+		directory := directories[index]
+		exists, err := fs.Exists(directory.To)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			return nil, fmt.Errorf("unable to rename `%s`, `%s` already exists", directory.From, directory.To)
+		}
+		files = append(files, directory)
+	}
+
+	return files, nil
+}
+
+// isLegacyDocument indicates if a file holds a document in the layout of an older version, which is a file without
+// extension that holds JSON or has metadata. Other files, like a README, are not documents and are left as they are.
+func isLegacyDocument(fs filesystem.Fs, location string, fileInfo os.FileInfo) (bool, error) {
+
+	if fileInfo.IsDir() || strings.HasPrefix(fileInfo.Name(), hiddenPrefix) {
+		return false, nil
+	}
+	if _, isDocument := documentName(fileInfo); isDocument {
+		return false, nil
+	}
+
+	hasMetadata, err := fs.Exists(metadataLocation(location))
+	if err != nil || hasMetadata {
+		return hasMetadata, err
+	}
+
+	bytes, err := fs.ReadFile(location)
+	if err != nil {
+		return false, err
+	}
+
+	return json.Valid(bytes), nil
+}
+
+// migratedName returns the name of a file or directory of the older layout in the current layout, without extension.
+// Names that were not encoded yet are encoded.
+func migratedName(name string) string {
+
+	segment, err := DecodeSegment(name)
+	if err != nil {
+		segment = name
+	}
+
+	return EncodeSegment(segment)
+}
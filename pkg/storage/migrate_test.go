@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestMigrateFileStore(t *testing.T) {
+
+	directory, err := ioutil.TempDir("", "lazy-rest")
+	if !assert.NoError(t, err, "Error occurred while creating test directory") {
+		return
+	}
+	defer os.RemoveAll(directory)
+
+	legacy := map[string]string{
+		"items/1":                 `{"id":"1"}`,
+		"items/a:b":               `{"id":"a:b"}`,
+		"items/nested/2":          `{"id":"2"}`,
+		"images/logo":             "PNG",
+		"images/.logo.meta":       `{"contentType":"image/png"}`,
+		".history/items/1/000001": `{"id":"1"}`,
+	}
+	for location, content := range legacy {
+		assert.NoError(t, os.MkdirAll(path.Join(directory, path.Dir(location)), 0777))
+		assert.NoError(t, ioutil.WriteFile(path.Join(directory, location), []byte(content), 0644))
+	}
+
+	migrations, err := MigrateFileStore(directory, true)
+	if assert.NoError(t, err) {
+		assert.Len(t, migrations, 5)
+	}
+	_, err = os.Stat(path.Join(directory, "items", "1"))
+	assert.NoError(t, err, "Nothing should be renamed in a dry run")
+
+	migrations, err = MigrateFileStore(directory, false)
+	if !assert.NoError(t, err) || !assert.Len(t, migrations, 5) {
+		return
+	}
+
+	store, err := NewFileStore(directory)
+	if !assert.NoError(t, err, "The store should start once the data directory has been migrated") {
+		return
+	}
+
+	ctx := context.Background()
+	for _, key := range []string{"items/1", "items/a:b", "items/nested/2"} {
+		_, exists, err := store.Get(ctx, key)
+		assert.NoError(t, err)
+		assert.True(t, exists, "Document `%s` should be migrated", key)
+	}
+
+	_, err = os.Stat(path.Join(directory, ".history", "items", "1", "000001.json"))
+	assert.NoError(t, err, "The history should be migrated as well")
+
+	document, exists, err := store.Get(ctx, "images/logo")
+	if assert.NoError(t, err) && assert.True(t, exists) {
+		assert.Equal(t, "image/png", document.Metadata.ContentType, "Data should be migrated together with its metadata")
+	}
+
+	migrations, err = MigrateFileStore(directory, false)
+	assert.NoError(t, err)
+	assert.Empty(t, migrations, "Migrated data directories should be left as they are")
+}
+
+func TestMigrateFileStoreKeepsExistingFiles(t *testing.T) {
+
+	directory, err := ioutil.TempDir("", "lazy-rest")
+	if !assert.NoError(t, err, "Error occurred while creating test directory") {
+		return
+	}
+	defer os.RemoveAll(directory)
+
+	assert.NoError(t, ioutil.WriteFile(path.Join(directory, "1"), []byte(`{"id":"old"}`), 0644))
+	assert.NoError(t, ioutil.WriteFile(path.Join(directory, "1.json"), []byte(`{"id":"new"}`), 0644))
+
+	_, err = MigrateFileStore(directory, false)
+	assert.Error(t, err, "Files should not be overwritten")
+
+	bytes, _ := ioutil.ReadFile(path.Join(directory, "1.json"))
+	assert.Equal(t, `{"id":"new"}`, string(bytes))
+	_, err = os.Stat(path.Join(directory, "1"))
+	assert.NoError(t, err, "Nothing should be renamed when any of the new names is taken")
+}
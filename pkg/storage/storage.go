@@ -16,118 +16,157 @@ limitations under the License.
 package storage
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"github.com/akleinloog/lazy-rest/app"
-	"github.com/akleinloog/lazy-rest/pkg/filesystem"
+	"github.com/akleinloog/lazy-rest/config"
+	"path"
+	"sort"
+	"strings"
+	"time"
 )
 
-var fs = filesystem.New(&app.Config)
+// Store is a backend that documents are stored in.
+// Keys are slash separated paths, a collection holds the documents whose keys are directly below its key.
+type Store interface {
 
-func Retrieve(key string) (interface{}, bool, error) {
+	// Get returns the document stored at the key, and indicates if it exists.
+	Get(ctx context.Context, key string) (*Document, bool, error)
 
-	exists, err := fs.Exists(key)
-	if err != nil {
-		app.Log.Error(err, "Error occurred while checking if location exists")
-		return nil, false, err
-	}
+	// Put stores the content at the key, and returns the stored document.
+	Put(ctx context.Context, key string, content interface{}) (*Document, error)
 
-	if exists {
-
-		isDir, err := fs.IsDir(key)
-		if err != nil {
-			app.Log.Error(err, "Error occurred while checking if location is a directory")
-			return nil, false, err
-		}
-		if isDir {
-			return nil, false, nil
-		}
-
-		bytes, err := fs.ReadFile(key)
-		if err != nil {
-			app.Log.Error(err, "Error occurred while reading content")
-			return nil, true, err
-		}
-
-		var content interface{}
-		err = json.Unmarshal(bytes, &content)
-		if err != nil {
-			app.Log.Error(err, "Error occurred while unmarshalling content from JSON")
-			return nil, true, err
-		}
-
-		return content, true, nil
-	}
+	// PutData stores data that is not JSON at the key exactly as it is, together with the metadata
+	// that describes it, and returns the stored document.
+	PutData(ctx context.Context, key string, data []byte, metadata Metadata) (*Document, error)
+
+	// Delete removes the document stored at the key, and indicates if it was present.
+	Delete(ctx context.Context, key string) (bool, error)
+
+	// List returns the documents stored directly in the collection at the key, ordered by key.
+	List(ctx context.Context, key string) ([]*Document, error)
 
-	return nil, false, nil
+	// Collections returns the names of the collections directly below the key that hold documents, directly or in
+	// collections below them, ordered by name. Reserved collections are left out, see ReservedPrefix.
+	Collections(ctx context.Context, key string) ([]string, error)
+
+	// Replace replaces all documents stored directly in the collection at the key with the contents, which are
+	// mapped by their name in the collection. Either all documents are replaced, or none are when an error occurs.
+	Replace(ctx context.Context, key string, contents map[string]interface{}) ([]*Document, error)
 }
 
-func RetrieveCollection(key string) (map[string]interface{}, error) {
+// ReservedPrefix starts the names of the collections that the server keeps its own records in, like the history of
+// documents. Stores leave reserved collections out of Collections, so they are hidden from the collections that hold
+// the documents, and clients can not use such names themselves.
+const ReservedPrefix = "."
 
-	var itemsInCollection = make(map[string]interface{})
+// IsReserved indicates if a name is reserved for the server.
+func IsReserved(name string) bool {
+	return strings.HasPrefix(name, ReservedPrefix)
+}
 
-	exists, err := fs.DirExists(key)
-	if err != nil {
-		app.Log.Error(err, "Error occurred while checking if directory exists")
-		return nil, err
-	}
+// childKey returns the key of a document in the collection at the key.
+func childKey(key string, name string) string {
+	return path.Join(key, name)
+}
 
-	if exists {
-		files, err := fs.ReadDir(key)
-		if err != nil {
-			app.Log.Error(err, "Error occurred while retrieving files in directory")
-			return nil, err
-		}
-
-		for index := range files {
-			fileInfo := files[index]
-			if !fileInfo.IsDir() {
-				content, exists, err := Retrieve(key + "/" + fileInfo.Name())
-
-				if err != nil {
-					app.Log.Error(err, "Error occurred while retrieving individual file in directory")
-					return nil, err
-				}
-
-				if exists {
-					itemsInCollection[fileInfo.Name()] = content
-				}
-			}
-		}
+// Document is content that is stored at a key, together with its version and when it was last stored.
+// JSON documents hold their decoded content, other documents hold their data and the metadata that describes it.
+type Document struct {
+	Key      string
+	Content  interface{}
+	Data     []byte
+	Metadata *Metadata
+	Version  string
+	Modified time.Time
+}
+
+// IsJSON indicates if the document holds JSON content, rather than data that is described by metadata.
+func (document *Document) IsJSON() bool {
+	return document.Metadata == nil
+}
+
+// Metadata describes data that is not JSON, so it can be served the way it was received.
+type Metadata struct {
+	ContentType     string `json:"contentType"`
+	ContentEncoding string `json:"contentEncoding,omitempty"`
+	Filename        string `json:"filename,omitempty"`
+}
+
+// New returns the store that is selected in the configuration.
+func New(configuration *config.Config) (Store, error) {
+	if configuration.InMemory() {
+		return NewMemoryStore(), nil
 	}
+	return NewFileStore(configuration.DataDir())
+}
 
-	return itemsInCollection, nil
+// sortedNames returns the names of the contents in order.
+func sortedNames(contents map[string]interface{}) []string {
+	names := make([]string, 0, len(contents))
+	for name := range contents {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
-func Store(key string, content interface{}) error {
+// encode converts content to the bytes that are stored.
+func encode(content interface{}) ([]byte, error) {
 
 	bytes, err := json.MarshalIndent(content, "", "\t")
 	if err != nil {
 		app.Log.Error(err, "Error marshalling content to JSON")
-		return err
+		return nil, err
 	}
 
-	err = fs.WriteFile(key, bytes)
+	return bytes, nil
+}
+
+// decode converts stored bytes into a document.
+func decode(key string, bytes []byte) (*Document, error) {
+
+	var content interface{}
+	err := json.Unmarshal(bytes, &content)
 	if err != nil {
-		app.Log.Error(err, "Error occurred while storing content")
-		return err
+		app.Log.Error(err, "Error occurred while unmarshalling content from JSON")
+		return nil, err
 	}
 
-	return nil
+	return &Document{Key: key, Content: content, Version: version(bytes)}, nil
 }
 
-func Remove(key string) (bool, error) {
+// Convert converts a value into the target through JSON, like the content of a document into a record or a record into
+// content. Content converted into an interface{} is decoded like stored JSON, so it can be changed without affecting
+// the value, and is written in the same way in any format.
+func Convert(value interface{}, target interface{}) error {
 
-	exists, err := fs.Exists(key)
+	bytes, err := json.Marshal(value)
 	if err != nil {
-		app.Log.Error(err, "Error occurred while checking if content exists")
-		return false, err
-	}
-	if exists {
-		err = fs.Remove(key)
-		if err != nil {
-			app.Log.Error(err, "Error occurred while removing content")
-			return false, err
-		}
+		return err
 	}
-	return exists, nil
+
+	return json.Unmarshal(bytes, target)
+}
+
+// dataDocument returns the document for data that is described by the metadata.
+func dataDocument(key string, data []byte, metadata Metadata) *Document {
+	return &Document{Key: key, Data: data, Metadata: &metadata, Version: dataVersion(data, metadata)}
+}
+
+// dataVersion calculates the version of stored data as a hash of its metadata and bytes,
+// so changing only the content type also results in a new version.
+func dataVersion(data []byte, metadata Metadata) string {
+	hash := sha256.New()
+	json.NewEncoder(hash).Encode(metadata)
+	hash.Write(data)
+	return hex.EncodeToString(hash.Sum(nil)[:16])
+}
+
+// version calculates the version of stored content as a hash of its bytes.
+func version(bytes []byte) string {
+	hash := sha256.Sum256(bytes)
+	return hex.EncodeToString(hash[:16])
 }
@@ -0,0 +1,485 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"github.com/akleinloog/lazy-rest/pkg/filesystem"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestFileStore(t *testing.T) {
+
+	directory, err := ioutil.TempDir("", "lazy-rest")
+	if !assert.NoError(t, err, "Error occurred while creating test directory") {
+		return
+	}
+	defer os.RemoveAll(directory)
+
+	store, err := NewFileStore(directory)
+	if assert.NoError(t, err, "Error occurred while creating file store") {
+		PutGetListAndDelete(t, store)
+	}
+}
+
+func TestFileStoreCreatesMissingDirectory(t *testing.T) {
+
+	directory, err := ioutil.TempDir("", "lazy-rest")
+	if !assert.NoError(t, err, "Error occurred while creating test directory") {
+		return
+	}
+	defer os.RemoveAll(directory)
+
+	_, err = NewFileStore(path.Join(directory, "missing", "data"))
+	if assert.NoError(t, err, "Error occurred while creating file store") {
+		assert.DirExists(t, path.Join(directory, "missing", "data"))
+	}
+}
+
+func TestFileStoreQuarantinesCorruptFiles(t *testing.T) {
+
+	directory, err := ioutil.TempDir("", "lazy-rest")
+	if !assert.NoError(t, err, "Error occurred while creating test directory") {
+		return
+	}
+	defer os.RemoveAll(directory)
+
+	items := path.Join(directory, "items")
+	assert.NoError(t, os.MkdirAll(items, 0777))
+	assert.NoError(t, ioutil.WriteFile(path.Join(items, "1.json"), []byte(`{"id":"1","na`), 0644))
+	assert.NoError(t, ioutil.WriteFile(path.Join(items, "2.json"), []byte(`{"id":"2"}`), 0644))
+	assert.NoError(t, ioutil.WriteFile(path.Join(items, ".3.json.tmp-123456"), []byte(`{"id":"3"}`), 0600))
+
+	store, err := NewFileStore(directory)
+	if !assert.NoError(t, err, "Corrupt files should not prevent the store from starting") {
+		return
+	}
+
+	ctx := context.Background()
+
+	_, exists, err := store.Get(ctx, "items/1")
+	assert.NoError(t, err)
+	assert.False(t, exists, "Corrupt files should be quarantined")
+
+	documents, err := store.List(ctx, "items")
+	if assert.NoError(t, err) && assert.Len(t, documents, 1) {
+		assert.Equal(t, "items/2", documents[0].Key)
+	}
+
+	_, err = os.Stat(path.Join(items, ".3.json.tmp-123456"))
+	assert.True(t, os.IsNotExist(err), "Temporary files that remain after a crash should be removed")
+
+	quarantined, err := ioutil.ReadDir(path.Join(directory, quarantineDirectory, "items"))
+	if assert.NoError(t, err) && assert.Len(t, quarantined, 1) {
+		bytes, _ := ioutil.ReadFile(path.Join(directory, quarantineDirectory, "items", quarantined[0].Name()))
+		assert.Equal(t, `{"id":"1","na`, string(bytes), "Quarantined files should be kept as they are")
+	}
+
+	assert.NoError(t, ioutil.WriteFile(path.Join(items, "2.json"), []byte(`{"id":`), 0644))
+	_, exists, err = store.Get(ctx, "items/2")
+	assert.NoError(t, err)
+	assert.False(t, exists, "Files that get corrupted later should be quarantined when read")
+}
+
+func TestMemoryStore(t *testing.T) {
+
+	PutGetListAndDelete(t, NewMemoryStore())
+}
+
+func TestStoresAreIsolated(t *testing.T) {
+
+	ctx := context.Background()
+	first, second := NewMemoryStore(), NewMemoryStore()
+
+	_, err := first.Put(ctx, "items/1", map[string]interface{}{"id": "1"})
+	assert.NoError(t, err, "Error occurred while storing content")
+
+	_, exists, err := second.Get(ctx, "items/1")
+	if assert.NoError(t, err, "Error occurred while retrieving content") {
+		assert.False(t, exists, "Content stored in one store should not exist in another")
+	}
+}
+
+func TestReplaceCollection(t *testing.T) {
+
+	directory, err := ioutil.TempDir("", "lazy-rest")
+	if !assert.NoError(t, err, "Error occurred while creating test directory") {
+		return
+	}
+	defer os.RemoveAll(directory)
+
+	fileStore, err := NewFileStore(directory)
+	if !assert.NoError(t, err, "Error occurred while creating file store") {
+		return
+	}
+
+	for _, store := range []Store{fileStore, NewMemoryStore()} {
+
+		ctx := context.Background()
+
+		_, err := store.Put(ctx, "items/1", map[string]interface{}{"id": "1"})
+		assert.NoError(t, err, "Error occurred while storing content")
+		_, err = store.Put(ctx, "items/2", map[string]interface{}{"id": "2"})
+		assert.NoError(t, err, "Error occurred while storing content")
+		_, err = store.Put(ctx, "items/nested/3", map[string]interface{}{"id": "3"})
+		assert.NoError(t, err, "Error occurred while storing content")
+
+		replaced, err := store.Replace(ctx, "items", map[string]interface{}{
+			"2": map[string]interface{}{"id": "2", "replaced": true},
+			"4": map[string]interface{}{"id": "4"},
+		})
+		if assert.NoError(t, err, "Error occurred while replacing collection") {
+			assert.Len(t, replaced, 2)
+		}
+
+		documents, err := store.List(ctx, "items")
+		if assert.NoError(t, err, "Error occurred while listing content") && assert.Len(t, documents, 2) {
+			assert.Equal(t, map[string]interface{}{"id": "2", "replaced": true}, documents[0].Content)
+			assert.Equal(t, "items/4", documents[1].Key)
+		}
+
+		_, exists, err := store.Get(ctx, "items/nested/3")
+		if assert.NoError(t, err, "Error occurred while retrieving content") {
+			assert.True(t, exists, "Nested collections should not be replaced")
+		}
+	}
+}
+
+// failingFs is a file system that fails to rename files to a location, to interrupt the store.
+type failingFs struct {
+	afero.Fs
+	failAt string
+}
+
+func (fs failingFs) Rename(location string, newLocation string) error {
+	if newLocation == fs.failAt {
+		return errors.New("injected failure")
+	}
+	return fs.Fs.Rename(location, newLocation)
+}
+
+func TestReplaceRollsBackOnFailure(t *testing.T) {
+
+	memFs := afero.NewMemMapFs()
+	store := &FileStore{fs: filesystem.New(failingFs{Fs: memFs, failAt: "items/4.json"})}
+	ctx := context.Background()
+
+	_, err := store.Put(ctx, "items/1", map[string]interface{}{"id": "1"})
+	assert.NoError(t, err, "Error occurred while storing content")
+	_, err = store.Put(ctx, "items/2", map[string]interface{}{"id": "2"})
+	assert.NoError(t, err, "Error occurred while storing content")
+	_, err = store.PutData(ctx, "items/3", []byte("text"), Metadata{ContentType: "text/plain"})
+	assert.NoError(t, err, "Error occurred while storing data")
+
+	before, err := store.List(ctx, "items")
+	if !assert.NoError(t, err, "Error occurred while listing content") {
+		return
+	}
+
+	_, err = store.Replace(ctx, "items", map[string]interface{}{
+		"2": map[string]interface{}{"id": "2", "replaced": true},
+		"3": map[string]interface{}{"id": "3"},
+		"4": map[string]interface{}{"id": "4"},
+	})
+	assert.Error(t, err, "Replace should fail when a document cannot be stored")
+
+	after, err := store.List(ctx, "items")
+	if assert.NoError(t, err, "Error occurred while listing content") && assert.Len(t, after, len(before)) {
+		for index := range before {
+			assert.Equal(t, before[index].Key, after[index].Key)
+			assert.Equal(t, before[index].Version, after[index].Version, "Documents should be restored when replace fails")
+		}
+	}
+
+	document, _, err := store.Get(ctx, "items/3")
+	if assert.NoError(t, err, "Error occurred while retrieving data") {
+		assert.Equal(t, "text/plain", document.Metadata.ContentType, "Metadata should be restored when replace fails")
+	}
+
+	files, err := afero.ReadDir(memFs, "items")
+	if assert.NoError(t, err) {
+		for _, file := range files {
+			assert.NotContains(t, file.Name(), backupSuffix, "Backups should not remain")
+			assert.NotContains(t, file.Name(), stagedSuffix, "Staged files should not remain")
+		}
+	}
+}
+
+func TestRecoverRestoresInterruptedReplace(t *testing.T) {
+
+	memFs := afero.NewMemMapFs()
+	store := &FileStore{fs: filesystem.New(memFs)}
+	ctx := context.Background()
+
+	_, err := store.Put(ctx, "items/1", map[string]interface{}{"id": "1"})
+	assert.NoError(t, err, "Error occurred while storing content")
+	_, err = store.Put(ctx, "items/2", map[string]interface{}{"id": "2"})
+	assert.NoError(t, err, "Error occurred while storing content")
+
+	// A replace that was interrupted after moving item 1 aside, and after writing the new version of item 2
+	assert.NoError(t, memFs.Rename("items/1.json", "items/.1.json.backup"))
+	assert.NoError(t, afero.WriteFile(memFs, "items/.2.json.backup", []byte(`{"id":"old"}`), 0644))
+
+	assert.NoError(t, store.recover())
+
+	_, exists, err := store.Get(ctx, "items/1")
+	if assert.NoError(t, err, "Error occurred while retrieving content") {
+		assert.True(t, exists, "A document that was moved aside should be put back")
+	}
+
+	document, _, err := store.Get(ctx, "items/2")
+	if assert.NoError(t, err, "Error occurred while retrieving content") {
+		assert.Equal(t, map[string]interface{}{"id": "2"}, document.Content, "A replaced document should be kept")
+	}
+
+	exists, _ = afero.Exists(memFs, "items/.2.json.backup")
+	assert.False(t, exists, "Backups should be removed")
+}
+
+func PutGetListAndDelete(t *testing.T, store Store) {
+
+	ctx := context.Background()
+	content := map[string]interface{}{"id": "1", "name": "Something"}
+
+	stored, err := store.Put(ctx, "items/1", content)
+	if !assert.NoError(t, err, "Error occurred while storing content") {
+		return
+	}
+	assert.NotEmpty(t, stored.Version, "Stored document should have a version")
+
+	_, err = store.Put(ctx, "items/2", map[string]interface{}{"id": "2"})
+	assert.NoError(t, err, "Error occurred while storing content")
+
+	_, err = store.Put(ctx, "items/nested/3", map[string]interface{}{"id": "3"})
+	assert.NoError(t, err, "Error occurred while storing content")
+
+	document, exists, err := store.Get(ctx, "items/1")
+	if assert.NoError(t, err, "Error occurred while retrieving content") && assert.True(t, exists, "Content does not exist") {
+		assert.Equal(t, "items/1", document.Key)
+		assert.Equal(t, stored.Version, document.Version, "Version should not change when content is retrieved")
+		assert.Equal(t, map[string]interface{}{"id": "1", "name": "Something"}, document.Content)
+	}
+
+	documents, err := store.List(ctx, "items")
+	if assert.NoError(t, err, "Error occurred while listing content") && assert.Len(t, documents, 2) {
+		assert.Equal(t, "items/1", documents[0].Key)
+		assert.Equal(t, "items/2", documents[1].Key)
+	}
+
+	_, exists, err = store.Get(ctx, "items")
+	if assert.NoError(t, err, "Error occurred while retrieving collection as document") {
+		assert.False(t, exists, "Collection should not exist as a document")
+	}
+
+	wasPresent, err := store.Delete(ctx, "items/1")
+	if assert.NoError(t, err, "Error occurred while removing content") {
+		assert.True(t, wasPresent, "Content was not present")
+	}
+
+	_, exists, err = store.Get(ctx, "items/1")
+	if assert.NoError(t, err, "Error occurred while checking if content still exists") {
+		assert.False(t, exists, "Content still exists")
+	}
+
+	wasPresent, err = store.Delete(ctx, "items/1")
+	if assert.NoError(t, err, "Error occurred while removing content again") {
+		assert.False(t, wasPresent, "Content was still present")
+	}
+}
+
+func TestDocumentsAndCollectionsCoexist(t *testing.T) {
+
+	directory, err := ioutil.TempDir("", "lazy-rest")
+	if !assert.NoError(t, err, "Error occurred while creating test directory") {
+		return
+	}
+	defer os.RemoveAll(directory)
+
+	fileStore, err := NewFileStore(directory)
+	if !assert.NoError(t, err, "Error occurred while creating file store") {
+		return
+	}
+
+	for _, store := range []Store{fileStore, NewMemoryStore()} {
+
+		ctx := context.Background()
+
+		_, err = store.Put(ctx, "items/1", map[string]interface{}{"id": "1"})
+		assert.NoError(t, err)
+		_, err = store.Put(ctx, "items/1/comments/a", map[string]interface{}{"id": "a"})
+		assert.NoError(t, err, "A collection should be stored below a document")
+		_, err = store.Put(ctx, "items/2.json", map[string]interface{}{"id": "2.json"})
+		assert.NoError(t, err)
+
+		document, exists, err := store.Get(ctx, "items/1")
+		if assert.NoError(t, err) && assert.True(t, exists, "The document should remain next to its collection") {
+			assert.Equal(t, map[string]interface{}{"id": "1"}, document.Content)
+		}
+
+		documents, err := store.List(ctx, "items")
+		if assert.NoError(t, err) && assert.Len(t, documents, 2, "Collections should not be listed as documents") {
+			assert.Equal(t, "items/1", documents[0].Key)
+			assert.Equal(t, "items/2.json", documents[1].Key)
+		}
+
+		documents, err = store.List(ctx, "items/1/comments")
+		if assert.NoError(t, err) && assert.Len(t, documents, 1) {
+			assert.Equal(t, "items/1/comments/a", documents[0].Key)
+		}
+
+		wasPresent, err := store.Delete(ctx, "items/1")
+		assert.NoError(t, err)
+		assert.True(t, wasPresent)
+
+		_, exists, err = store.Get(ctx, "items/1/comments/a")
+		assert.NoError(t, err)
+		assert.True(t, exists, "Deleting a document should keep the collection below it")
+	}
+
+	_, err = os.Stat(path.Join(directory, "items", "1", "comments", "a.json"))
+	assert.NoError(t, err, "Documents should be stored in files with the .json extension")
+}
+
+func TestCollections(t *testing.T) {
+
+	directory, err := ioutil.TempDir("", "lazy-rest")
+	if !assert.NoError(t, err, "Error occurred while creating test directory") {
+		return
+	}
+	defer os.RemoveAll(directory)
+
+	fileStore, err := NewFileStore(directory)
+	if !assert.NoError(t, err, "Error occurred while creating file store") {
+		return
+	}
+
+	for _, store := range []Store{fileStore, NewMemoryStore()} {
+
+		ctx := context.Background()
+
+		for _, key := range []string{"api/items/1", "api/users/a:b/roles/admin", "api/orders/1", "top", ".history/top/1"} {
+			_, err = store.Put(ctx, key, map[string]interface{}{"id": path.Base(key)})
+			assert.NoError(t, err)
+		}
+		_, err = store.Delete(ctx, "api/orders/1")
+		assert.NoError(t, err)
+
+		names, err := store.Collections(ctx, "")
+		if assert.NoError(t, err) {
+			assert.Equal(t, []string{"api"}, names, "Hidden collections should be left out")
+		}
+
+		names, err = store.Collections(ctx, "api")
+		if assert.NoError(t, err) {
+			assert.Equal(t, []string{"items", "users"}, names, "Collections without documents should be left out")
+		}
+
+		names, err = store.Collections(ctx, "api/users")
+		if assert.NoError(t, err) {
+			assert.Equal(t, []string{"a:b"}, names)
+		}
+
+		names, err = store.Collections(ctx, "missing")
+		assert.NoError(t, err)
+		assert.Empty(t, names)
+	}
+}
+
+func TestFileStoreRefusesLegacyLayout(t *testing.T) {
+
+	directory, err := ioutil.TempDir("", "lazy-rest")
+	if !assert.NoError(t, err, "Error occurred while creating test directory") {
+		return
+	}
+	defer os.RemoveAll(directory)
+
+	assert.NoError(t, os.MkdirAll(path.Join(directory, "items"), 0777))
+	assert.NoError(t, ioutil.WriteFile(path.Join(directory, "items", "1"), []byte(`{"id":"1"}`), 0644))
+
+	_, err = NewFileStore(directory)
+	assert.True(t, errors.Is(err, ErrLegacyLayout), "Data directories of an older version should be migrated first")
+
+	_, err = os.Stat(path.Join(directory, "items", "1"))
+	assert.NoError(t, err, "Nothing should be changed in data directories of an older version")
+}
+
+func TestFileStoreIgnoresOtherFiles(t *testing.T) {
+
+	directory, err := ioutil.TempDir("", "lazy-rest")
+	if !assert.NoError(t, err, "Error occurred while creating test directory") {
+		return
+	}
+	defer os.RemoveAll(directory)
+
+	assert.NoError(t, ioutil.WriteFile(path.Join(directory, "README"), []byte("# Data of the demo"), 0644))
+	assert.NoError(t, ioutil.WriteFile(path.Join(directory, "LICENSE"), []byte("Apache License"), 0644))
+
+	store, err := NewFileStore(directory)
+	if !assert.NoError(t, err, "Files that are not documents should not prevent the store from starting") {
+		return
+	}
+
+	_, err = os.Stat(path.Join(directory, "README"))
+	assert.NoError(t, err, "Files that are not documents should be left as they are")
+
+	migrations, err := MigrateFileStore(directory, true)
+	if assert.NoError(t, err) {
+		assert.Empty(t, migrations, "Files that are not documents should not be migrated")
+	}
+
+	documents, err := store.List(context.Background(), "")
+	if assert.NoError(t, err) {
+		assert.Empty(t, documents)
+	}
+}
+
+func TestPutData(t *testing.T) {
+
+	directory, err := ioutil.TempDir("", "lazy-rest")
+	if !assert.NoError(t, err, "Error occurred while creating test directory") {
+		return
+	}
+	defer os.RemoveAll(directory)
+
+	fileStore, err := NewFileStore(directory)
+	if !assert.NoError(t, err, "Error occurred while creating file store") {
+		return
+	}
+
+	for _, store := range []Store{fileStore, NewMemoryStore()} {
+
+		ctx := context.Background()
+		data := []byte{0x89, 'P', 'N', 'G', 0x00, 0xff}
+		metadata := Metadata{ContentType: "image/png", Filename: "logo.png"}
+
+		stored, err := store.PutData(ctx, "images/logo", data, metadata)
+		if !assert.NoError(t, err, "Error occurred while storing data") {
+			return
+		}
+
+		document, exists, err := store.Get(ctx, "images/logo")
+		if assert.NoError(t, err, "Error occurred while retrieving data") && assert.True(t, exists, "Data does not exist") {
+			assert.False(t, document.IsJSON(), "Data should not be JSON")
+			assert.Equal(t, data, document.Data)
+			assert.Equal(t, metadata, *document.Metadata)
+			assert.Equal(t, stored.Version, document.Version)
+		}
+
+		documents, err := store.List(ctx, "images")
+		if assert.NoError(t, err, "Error occurred while listing content") {
+			assert.Len(t, documents, 1, "Metadata should not be listed as a document")
+		}
+
+		_, err = store.Put(ctx, "images/logo", map[string]interface{}{"id": "logo"})
+		assert.NoError(t, err, "Error occurred while storing content")
+
+		document, _, err = store.Get(ctx, "images/logo")
+		if assert.NoError(t, err, "Error occurred while retrieving content") {
+			assert.True(t, document.IsJSON(), "Metadata should be removed when JSON is stored")
+		}
+	}
+}